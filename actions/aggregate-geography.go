@@ -0,0 +1,362 @@
+package actions
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/USACE/go-consequences/consequences"
+	"github.com/USACE/go-consequences/resultswriters"
+	"github.com/dewberry/gdal"
+	"github.com/usace-cloud-compute/cc-go-sdk"
+)
+
+const (
+	inputFilePathKey                string = "inputFilePath" //any compute or summary output with structure points
+	inputDriverKey                  string = "inputDriver"
+	inputTableNameKey               string = "inputTableName"
+	zoneFilePathKey                 string = "zoneFilePath" //optional polygon layer, when absent zones come from the cbfips prefix
+	zoneDriverKey                   string = "zoneDriver"
+	zoneTableNameKey                string = "zoneTableName"
+	zoneIdFieldKey                  string = "zoneIdField"
+	cbfipsLevelKey                  string = "cbfipsLevel"        //one of state, county, tract, block-group or block. defaults to tract.
+	inventoryTableNameKey           string = "inventoryTableName" //optional, used with Inventory to report exposure. defaults to nsi.
+	aggregateCsvFilePathKey         string = "aggregateCsvFilePath"
+	aggregateSpatialFilePathKey     string = "aggregateSpatialFilePath"
+	aggregateByGeographyActionName  string = "aggregate-by-geography"
+	aggregateSpatialOutputTableName string = "zones"
+)
+
+func init() {
+	cc.ActionRegistry.RegisterAction(aggregateByGeographyActionName, &AggregateByGeographyAction{})
+}
+
+// AggregateByGeographyAction totals structure level outputs by census geography or by the polygons of a zone layer.
+type AggregateByGeographyAction struct {
+	cc.ActionRunnerBase
+}
+
+// cbfipsPrefixLengths is the number of leading digits of a census block fips code that identify each geography.
+var cbfipsPrefixLengths = map[string]int{
+	"state":       2,
+	"county":      5,
+	"tract":       11,
+	"block-group": 12,
+	"block":       15,
+}
+
+// cbfipsZone returns the zone of a census block fips code at the requested geography.
+func cbfipsZone(cbfips string, level string) (string, error) {
+	n, ok := cbfipsPrefixLengths[level]
+	if !ok {
+		return "", errors.New("unrecognized cbfips level " + level + ", expected one of state, county, tract, block-group or block")
+	}
+	cbfips = strings.TrimSpace(cbfips)
+	if len(cbfips) < n {
+		return "", fmt.Errorf("cbfips %v is too short for the %v level", cbfips, level)
+	}
+	return cbfips[:n], nil
+}
+
+// ZoneAggregate holds the totals of all structures within a zone.
+type ZoneAggregate struct {
+	Zone            string
+	X               float64 //zone centroid, or the mean structure location when zones come from cbfips
+	Y               float64
+	StructureCount  int32
+	WetCount        int32
+	StructureDamage float64
+	ContentDamage   float64
+	TotalDamage     float64
+	AAL             float64
+	Exposure        float64
+	sumX            float64
+	sumY            float64
+	hasCentroid     bool
+}
+
+// aggregateRow is the subset of a structure row that is aggregated.
+type aggregateRow struct {
+	Fdid            string
+	X               float64
+	Y               float64
+	StructureDamage float64
+	ContentDamage   float64
+	AAL             float64
+	Wet             bool
+}
+
+// zoneAggregator accumulates structure rows into zones, exposure is looked up by fd_id when an inventory is provided.
+type zoneAggregator struct {
+	zones    map[string]*ZoneAggregate
+	exposure map[string]float64
+}
+
+func initZoneAggregator(exposure map[string]float64) *zoneAggregator {
+	return &zoneAggregator{zones: make(map[string]*ZoneAggregate), exposure: exposure}
+}
+
+// setCentroid fixes the location of a zone, zones without a centroid report the mean location of their structures.
+func (za *zoneAggregator) setCentroid(zone string, x float64, y float64) {
+	za.zone(zone)
+	za.zones[zone].X = x
+	za.zones[zone].Y = y
+	za.zones[zone].hasCentroid = true
+}
+func (za *zoneAggregator) zone(zone string) *ZoneAggregate {
+	z, ok := za.zones[zone]
+	if !ok {
+		z = &ZoneAggregate{Zone: zone}
+		za.zones[zone] = z
+	}
+	return z
+}
+func (za *zoneAggregator) add(zone string, r aggregateRow) {
+	z := za.zone(zone)
+	z.StructureCount++
+	if r.Wet {
+		z.WetCount++
+	}
+	z.StructureDamage += r.StructureDamage
+	z.ContentDamage += r.ContentDamage
+	z.TotalDamage += r.StructureDamage + r.ContentDamage
+	z.AAL += r.AAL
+	z.Exposure += za.exposure[r.Fdid]
+	z.sumX += r.X
+	z.sumY += r.Y
+}
+
+// results returns the zones sorted by zone id.
+func (za *zoneAggregator) results() []ZoneAggregate {
+	results := make([]ZoneAggregate, 0, len(za.zones))
+	for _, z := range za.zones {
+		r := *z
+		if !r.hasCentroid && r.StructureCount > 0 {
+			r.X = r.sumX / float64(r.StructureCount)
+			r.Y = r.sumY / float64(r.StructureCount)
+		}
+		results = append(results, r)
+	}
+	sort.Slice(results, func(i int, j int) bool { return results[i].Zone < results[j].Zone })
+	return results
+}
+
+var zoneAggregateHeaders = []string{"zone", "x", "y", "n_struct", "n_wet", "sd", "cd", "td", "aal", "exposure"}
+
+func writeZoneAggregatesCsv(output io.Writer, zones []ZoneAggregate) error {
+	w := bufio.NewWriter(output)
+	w.WriteString(strings.Join(zoneAggregateHeaders, ",") + "\n")
+	for _, z := range zones {
+		w.WriteString(fmt.Sprintf("%v,%v,%v,%v,%v,%.2f,%.2f,%.2f,%.2f,%.2f\n", z.Zone, z.X, z.Y, z.StructureCount, z.WetCount, z.StructureDamage, z.ContentDamage, z.TotalDamage, z.AAL, z.Exposure))
+	}
+	return w.Flush()
+}
+
+// aggregateFields locates the columns of a compute output or a summary output, a missing column is -1.
+type aggregateFields struct {
+	fdid, x, y, cbfips, structure, content, aal, multihazard, depth, daep int
+}
+
+func firstFieldIndex(def gdal.FeatureDefinition, names ...string) int {
+	for _, n := range names {
+		idx := def.FieldIndex(n)
+		if idx >= 0 {
+			return idx
+		}
+	}
+	return -1
+}
+func locateAggregateFields(def gdal.FeatureDefinition) aggregateFields {
+	return aggregateFields{
+		fdid:        def.FieldIndex("fd_id"),
+		x:           def.FieldIndex("x"),
+		y:           def.FieldIndex("y"),
+		cbfips:      def.FieldIndex("cbfips"),
+		structure:   firstFieldIndex(def, "structure", "structure damage"),
+		content:     firstFieldIndex(def, "content da", "content damage"),
+		aal:         def.FieldIndex("TAAL"),
+		multihazard: def.FieldIndex("multihazar"),
+		depth:       def.FieldIndex("depth"),
+		daep:        def.FieldIndex("DAEP"),
+	}
+}
+func fieldOrZero(f *gdal.Feature, idx int) float64 {
+	if idx < 0 {
+		return 0
+	}
+	return f.FieldAsFloat64(idx)
+}
+
+// readAggregateRow reads a structure, it is wet when it has depth, a chance of depth, or damage.
+func (af aggregateFields) readAggregateRow(f *gdal.Feature) aggregateRow {
+	r := aggregateRow{
+		Fdid:            f.FieldAsString(af.fdid),
+		X:               fieldOrZero(f, af.x),
+		Y:               fieldOrZero(f, af.y),
+		StructureDamage: fieldOrZero(f, af.structure),
+		ContentDamage:   fieldOrZero(f, af.content),
+		AAL:             fieldOrZero(f, af.aal),
+	}
+	switch {
+	case af.multihazard >= 0:
+		depth, err := parseMultiHazardString(f.FieldAsString(af.multihazard), "depth")
+		r.Wet = err == nil && depth > 0
+	case af.depth >= 0:
+		r.Wet = f.FieldAsFloat64(af.depth) > 0
+	case af.daep >= 0:
+		r.Wet = f.FieldAsFloat64(af.daep) > 0
+	default:
+		r.Wet = r.StructureDamage+r.ContentDamage > 0
+	}
+	return r
+}
+
+// readExposure reads the structure and content value of every structure in an inventory by fd_id.
+func readExposure(path string, driver string, tablename string) (map[string]float64, error) {
+	ds, ok := gdal.OGRDriverByName(driver).Open(path, int(gdal.ReadOnly))
+	if !ok {
+		return nil, errors.New("error opening inventory " + path)
+	}
+	defer ds.Destroy()
+	l := ds.LayerByName(tablename)
+	def := l.Definition()
+	fdidIdx := def.FieldIndex("fd_id")
+	structureIdx := def.FieldIndex("val_struct")
+	contentIdx := def.FieldIndex("val_cont")
+	if fdidIdx < 0 || structureIdx < 0 {
+		return nil, errors.New("inventory " + path + " requires fd_id and val_struct")
+	}
+	exposure := make(map[string]float64)
+	for f := l.NextFeature(); f != nil; f = l.NextFeature() {
+		exposure[f.FieldAsString(fdidIdx)] = f.FieldAsFloat64(structureIdx) + fieldOrZero(f, contentIdx)
+		f.Destroy()
+	}
+	return exposure, nil
+}
+
+func (ar *AggregateByGeographyAction) Run() error {
+	a := ar.Action
+	inputFilePath := a.Attributes.GetStringOrFail(inputFilePathKey)
+	inputDriver := a.Attributes.GetStringOrFail(inputDriverKey)
+	inputTableName := a.Attributes.GetStringOrFail(inputTableNameKey)
+	zoneFilePath := a.Attributes.GetStringOrDefault(zoneFilePathKey, "")
+	csvFilePath := a.Attributes.GetStringOrFail(aggregateCsvFilePathKey)
+	spatialFilePath := a.Attributes.GetStringOrFail(aggregateSpatialFilePathKey)
+	spatialDriver := a.Attributes.GetStringOrDefault(spatialOutputDriverKey, "GPKG")
+	inventoryPath := a.Attributes.GetStringOrDefault(inventoryPathKey, "")
+
+	exposure := make(map[string]float64)
+	if inventoryPath != "" {
+		var err error
+		exposure, err = readExposure(inventoryPath, a.Attributes.GetStringOrFail(inventoryDriverKey), a.Attributes.GetStringOrDefault(inventoryTableNameKey, "nsi"))
+		if err != nil {
+			return err
+		}
+	} else {
+		log.Println("no inventory provided, exposure will be reported as zero")
+	}
+	ds, ok := gdal.OGRDriverByName(inputDriver).Open(inputFilePath, int(gdal.ReadOnly))
+	if !ok {
+		return errors.New("error opening " + inputFilePath)
+	}
+	defer ds.Destroy()
+	l := ds.LayerByName(inputTableName)
+	wkt, _ := l.SpatialReference().ToWKT()
+	fields := locateAggregateFields(l.Definition())
+	if fields.fdid < 0 {
+		return errors.New(inputFilePath + " does not have an fd_id column")
+	}
+	aggregator := initZoneAggregator(exposure)
+	if zoneFilePath != "" {
+		err := aggregateByZoneLayer(l, fields, aggregator, zoneFilePath, a.Attributes.GetStringOrFail(zoneDriverKey), a.Attributes.GetStringOrFail(zoneTableNameKey), a.Attributes.GetStringOrFail(zoneIdFieldKey))
+		if err != nil {
+			return err
+		}
+	} else {
+		level := a.Attributes.GetStringOrDefault(cbfipsLevelKey, "tract")
+		if fields.cbfips < 0 {
+			return errors.New(inputFilePath + " does not have a cbfips column, provide a zone layer instead")
+		}
+		for f := l.NextFeature(); f != nil; f = l.NextFeature() {
+			zone, err := cbfipsZone(f.FieldAsString(fields.cbfips), level)
+			if err != nil {
+				f.Destroy()
+				return err
+			}
+			aggregator.add(zone, fields.readAggregateRow(f))
+			f.Destroy()
+		}
+	}
+	zones := aggregator.results()
+	csvFile, err := os.Create(csvFilePath)
+	if err != nil {
+		return err
+	}
+	defer csvFile.Close()
+	err = writeZoneAggregatesCsv(csvFile, zones)
+	if err != nil {
+		return err
+	}
+	rw, err := resultswriters.InitSpatialResultsWriter_WKT_Projected(spatialFilePath, aggregateSpatialOutputTableName, spatialDriver, wkt)
+	if err != nil {
+		return err
+	}
+	defer rw.Close()
+	for _, z := range zones {
+		rw.Write(consequences.Result{
+			Headers: zoneAggregateHeaders,
+			Result:  []interface{}{z.Zone, z.X, z.Y, z.StructureCount, z.WetCount, z.StructureDamage, z.ContentDamage, z.TotalDamage, z.AAL, z.Exposure},
+		})
+	}
+	return nil
+}
+
+// aggregateByZoneLayer assigns each structure to the first zone polygon containing it, zones are reprojected to the structures.
+func aggregateByZoneLayer(l gdal.Layer, fields aggregateFields, aggregator *zoneAggregator, path string, driver string, tablename string, idField string) error {
+	zds, ok := gdal.OGRDriverByName(driver).Open(path, int(gdal.ReadOnly))
+	if !ok {
+		return errors.New("error opening zone layer " + path)
+	}
+	defer zds.Destroy()
+	zl := zds.LayerByName(tablename)
+	idIdx := zl.Definition().FieldIndex(idField)
+	if idIdx < 0 {
+		return errors.New("zone layer " + path + " does not have a " + idField + " column")
+	}
+	structureSR := l.SpatialReference()
+	reproject := !zl.SpatialReference().IsSame(structureSR)
+	assigned := make(map[string]bool)
+	for zf := zl.NextFeature(); zf != nil; zf = zl.NextFeature() {
+		zone := zf.FieldAsString(idIdx)
+		geom := zf.Geometry().Clone()
+		if reproject {
+			err := geom.TransformTo(structureSR)
+			if err != nil {
+				geom.Destroy()
+				zf.Destroy()
+				return err
+			}
+		}
+		centroid := geom.Centroid()
+		aggregator.setCentroid(zone, centroid.X(0), centroid.Y(0))
+		centroid.Destroy()
+		l.SetSpatialFilter(geom)
+		l.ResetReading()
+		for f := l.NextFeature(); f != nil; f = l.NextFeature() {
+			r := fields.readAggregateRow(f)
+			if !assigned[r.Fdid] && geom.Contains(f.Geometry()) {
+				assigned[r.Fdid] = true
+				aggregator.add(zone, r)
+			}
+			f.Destroy()
+		}
+		geom.Destroy()
+		zf.Destroy()
+	}
+	return nil
+}
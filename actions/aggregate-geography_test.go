@@ -0,0 +1,48 @@
+package actions
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_CbfipsZone(t *testing.T) {
+	cbfips := "060372073011002"
+	expected := map[string]string{"state": "06", "county": "06037", "tract": "06037207301", "block-group": "060372073011", "block": cbfips}
+	for level, e := range expected {
+		zone, err := cbfipsZone(cbfips, level)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if zone != e {
+			t.Errorf("expected %v zone %v, got %v", level, e, zone)
+		}
+	}
+	_, err := cbfipsZone(cbfips, "huc8")
+	if err == nil {
+		t.Errorf("expected an unknown level to be rejected")
+	}
+	_, err = cbfipsZone("0603", "tract")
+	if err == nil {
+		t.Errorf("expected a short cbfips to be rejected")
+	}
+}
+
+func Test_ZoneAggregator(t *testing.T) {
+	aggregator := initZoneAggregator(map[string]float64{"a": 100, "b": 200, "c": 50})
+	aggregator.add("06037", aggregateRow{Fdid: "a", X: 0, Y: 0, StructureDamage: 10, ContentDamage: 5, AAL: 1, Wet: true})
+	aggregator.add("06037", aggregateRow{Fdid: "b", X: 2, Y: 4, Wet: false})
+	aggregator.setCentroid("06001", 7, 8)
+	aggregator.add("06001", aggregateRow{Fdid: "c", X: 100, Y: 100, StructureDamage: 3, AAL: 0.5, Wet: true})
+	zones := aggregator.results()
+	sb := strings.Builder{}
+	err := writeZoneAggregatesCsv(&sb, zones)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "zone,x,y,n_struct,n_wet,sd,cd,td,aal,exposure\n" +
+		"06001,7,8,1,1,3.00,0.00,3.00,0.50,50.00\n" +
+		"06037,1,2,2,1,10.00,5.00,15.00,1.00,300.00\n"
+	if sb.String() != expected {
+		t.Errorf("expected\n%v got\n%v", expected, sb.String())
+	}
+}
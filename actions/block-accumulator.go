@@ -0,0 +1,653 @@
+package actions
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// BlockStatistic describes how the events within a block are reduced to a single value per structure.
+type BlockStatistic string
+
+const (
+	BlockMaximum  BlockStatistic = "max"       //the largest value observed in the block
+	BlockSum      BlockStatistic = "sum"       //the sum of all values observed in the block
+	BlockCountWet BlockStatistic = "count-wet" //the number of events in the block with a value greater than zero
+)
+
+// maxOpenSpillRuns bounds the number of spill files merged at once, larger sets of runs are merged in passes.
+var maxOpenSpillRuns = 64
+
+// ParseBlockStatistic converts an action attribute into a BlockStatistic, an empty string is treated as max.
+func ParseBlockStatistic(s string) (BlockStatistic, error) {
+	switch BlockStatistic(s) {
+	case "", BlockMaximum:
+		return BlockMaximum, nil
+	case BlockSum:
+		return BlockSum, nil
+	case BlockCountWet:
+		return BlockCountWet, nil
+	default:
+		return BlockMaximum, errors.New("unrecognized block statistic " + s + ", expected one of max, sum or count-wet")
+	}
+}
+
+// blockValue tracks the statistic for one parameter and the event producing the largest single value.
+type blockValue struct {
+	EventValue
+	peak float64
+}
+
+func (bv *blockValue) update(statistic BlockStatistic, event int32, value float64) {
+	if value > bv.peak {
+		bv.peak = value
+		bv.EventNumber = event
+	}
+	switch statistic {
+	case BlockSum:
+		bv.Value += value
+	case BlockCountWet:
+		if value > 0 {
+			bv.Value++
+		}
+	default:
+		if value > bv.Value {
+			bv.Value = value
+		}
+	}
+}
+func initBlockValue(statistic BlockStatistic, event int32, value float64) blockValue {
+	bv := blockValue{EventValue: EventValue{EventNumber: event, Value: value}, peak: value}
+	if statistic == BlockCountWet {
+		bv.Value = 0
+		if value > 0 {
+			bv.Value = 1
+		}
+	}
+	return bv
+}
+
+// structureBlock holds the running statistics for one structure in the current block.
+type structureBlock struct {
+	x                float64
+	y                float64
+	damageCategory   string
+	occupancyType    string
+	structureDamage  blockValue
+	contentDamage    blockValue
+	totalDamage      blockValue
+	depth            blockValue
+	velocity         blockValue
+	duration         blockValue
+	populationAtRisk blockValue
+	lifeLoss         blockValue
+}
+
+func (sb structureBlock) toBlockResult(fdid string) ConsequencesBlockResult {
+	return ConsequencesBlockResult{
+		Fdid:             fdid,
+		X:                sb.x,
+		Y:                sb.y,
+		DamageCategory:   sb.damageCategory,
+		OccupancyType:    sb.occupancyType,
+		StructureDamage:  sb.structureDamage.EventValue,
+		ContentDamage:    sb.contentDamage.EventValue,
+		TotalDamage:      sb.totalDamage.EventValue,
+		Depth:            sb.depth.EventValue,
+		Velocity:         sb.velocity.EventValue,
+		Duration:         sb.duration.EventValue,
+		PopulationAtRisk: sb.populationAtRisk.EventValue,
+		LifeLoss:         sb.lifeLoss.EventValue,
+	}
+}
+
+// WatershedBlockTotal is the sum of the reduced total damage across all structures in a block.
+type WatershedBlockTotal struct {
+	BlockNumber      int32
+	TotalDamage      float64
+	PopulationAtRisk float64            //the sum of the reduced population at risk
+	LifeLoss         float64            //the sum of the reduced life loss
+	CategoryDamage   map[string]float64 //total damage by structure damage category
+	OccupancyDamage  map[string]float64 //total damage by structure occupancy type
+	DrivingEvent     EventValue         //the event in the block with the largest watershed total damage
+}
+
+// EventDamage is the total damage of a single event across all structures, it is not reduced by the block statistic.
+type EventDamage struct {
+	BlockNumber     int32
+	EventNumber     int32
+	TotalDamage     float64
+	CategoryDamage  map[string]float64
+	OccupancyDamage map[string]float64
+}
+
+func (ed *EventDamage) add(r ConsequenceResult) {
+	ed.TotalDamage += r.StructDamage + r.ContentDamage
+	ed.CategoryDamage[r.DamageCategory] += r.StructDamage + r.ContentDamage
+	ed.OccupancyDamage[r.OccupancyType] += r.StructDamage + r.ContentDamage
+}
+
+// BlockAccumulator reduces per event structure results into one value per structure per block.
+// only the block currently being read is held in memory, results for a block are expected to be added together.
+// when a spill directory is set each completed block is written to disk as a run sorted by fd_id,
+// and the runs are merged to provide every structure's block values without holding the realization in memory.
+type BlockAccumulator struct {
+	Statistic      BlockStatistic
+	SpillDirectory string
+	spill          bool
+	current        map[string]*structureBlock
+	currentBlock   int32
+	open           bool
+	blocks         []int32
+	totals         map[int32]float64
+	watershed      []WatershedBlockTotal
+	eventDamages   map[int32]*EventDamage
+	runs           []string
+	blockHandler   func(block int32, results []ConsequencesBlockResult) error
+	eventHandler   func(events []EventDamage) error
+}
+
+// InitBlockAccumulator creates an empty accumulator that reduces each block with the given statistic.
+func InitBlockAccumulator(statistic BlockStatistic) *BlockAccumulator {
+	return &BlockAccumulator{
+		Statistic: statistic,
+		current:   make(map[string]*structureBlock),
+		blocks:    make([]int32, 0),
+		totals:    make(map[int32]float64),
+		watershed: make([]WatershedBlockTotal, 0),
+		runs:      make([]string, 0),
+	}
+}
+
+// SetSpillDirectory enables writing each completed block to disk so that EachStructure can be used.
+func (ba *BlockAccumulator) SetSpillDirectory(directory string) error {
+	dir, err := os.MkdirTemp(directory, "block-runs-")
+	if err != nil {
+		return err
+	}
+	ba.SpillDirectory = dir
+	ba.spill = true
+	return nil
+}
+
+// SetBlockHandler registers a function that receives every structure's result for a block, sorted by fd_id, as each block completes.
+func (ba *BlockAccumulator) SetBlockHandler(handler func(block int32, results []ConsequencesBlockResult) error) {
+	ba.blockHandler = handler
+}
+
+// SetEventHandler registers a function that receives the damage of every event in a block, in event order, as each block completes.
+// event damages are not kept once the handler returns.
+func (ba *BlockAccumulator) SetEventHandler(handler func(events []EventDamage) error) {
+	ba.eventHandler = handler
+}
+
+// BeginBlock completes the current block and starts a new one, blocks that never receive a result are dry and count as zero damage.
+func (ba *BlockAccumulator) BeginBlock(block int32) error {
+	err := ba.Flush()
+	if err != nil {
+		return err
+	}
+	ba.blocks = append(ba.blocks, block)
+	ba.currentBlock = block
+	ba.eventDamages = make(map[int32]*EventDamage)
+	ba.open = true
+	return nil
+}
+
+// Add records a single structure result for an event within a block, a new block is begun when the block changes.
+func (ba *BlockAccumulator) Add(block int32, r ConsequenceResult) error {
+	if !ba.open || ba.currentBlock != block {
+		err := ba.BeginBlock(block)
+		if err != nil {
+			return err
+		}
+	}
+	ed, ok := ba.eventDamages[r.EventNumber]
+	if !ok {
+		ed = &EventDamage{BlockNumber: block, EventNumber: r.EventNumber, CategoryDamage: make(map[string]float64), OccupancyDamage: make(map[string]float64)}
+		ba.eventDamages[r.EventNumber] = ed
+	}
+	ed.add(r)
+	s, ok := ba.current[r.Fdid]
+	if !ok {
+		ba.current[r.Fdid] = &structureBlock{
+			x:                r.X,
+			y:                r.Y,
+			damageCategory:   r.DamageCategory,
+			occupancyType:    r.OccupancyType,
+			structureDamage:  initBlockValue(ba.Statistic, r.EventNumber, r.StructDamage),
+			contentDamage:    initBlockValue(ba.Statistic, r.EventNumber, r.ContentDamage),
+			totalDamage:      initBlockValue(ba.Statistic, r.EventNumber, r.StructDamage+r.ContentDamage),
+			depth:            initBlockValue(ba.Statistic, r.EventNumber, r.Depth),
+			velocity:         initBlockValue(ba.Statistic, r.EventNumber, r.Velocity),
+			duration:         initBlockValue(ba.Statistic, r.EventNumber, r.Duration),
+			populationAtRisk: initBlockValue(ba.Statistic, r.EventNumber, r.PopulationAtRisk),
+			lifeLoss:         initBlockValue(ba.Statistic, r.EventNumber, r.LifeLoss),
+		}
+		return nil
+	}
+	s.structureDamage.update(ba.Statistic, r.EventNumber, r.StructDamage)
+	s.contentDamage.update(ba.Statistic, r.EventNumber, r.ContentDamage)
+	s.totalDamage.update(ba.Statistic, r.EventNumber, r.StructDamage+r.ContentDamage)
+	s.depth.update(ba.Statistic, r.EventNumber, r.Depth)
+	s.velocity.update(ba.Statistic, r.EventNumber, r.Velocity)
+	s.duration.update(ba.Statistic, r.EventNumber, r.Duration)
+	s.populationAtRisk.update(ba.Statistic, r.EventNumber, r.PopulationAtRisk)
+	s.lifeLoss.update(ba.Statistic, r.EventNumber, r.LifeLoss)
+	return nil
+}
+
+// Flush completes the current block, it is called by Add when a new block starts and by EachStructure.
+func (ba *BlockAccumulator) Flush() error {
+	if !ba.open {
+		return nil
+	}
+	ba.open = false
+	fdids := make([]string, 0, len(ba.current))
+	summary := WatershedBlockTotal{BlockNumber: ba.currentBlock, CategoryDamage: make(map[string]float64), OccupancyDamage: make(map[string]float64)}
+	for fdid, s := range ba.current {
+		fdids = append(fdids, fdid)
+		summary.TotalDamage += s.totalDamage.Value
+		summary.PopulationAtRisk += s.populationAtRisk.Value
+		summary.LifeLoss += s.lifeLoss.Value
+		summary.CategoryDamage[s.damageCategory] += s.totalDamage.Value
+		summary.OccupancyDamage[s.occupancyType] += s.totalDamage.Value
+	}
+	sort.Strings(fdids)
+	//events are kept in event order, the driving event is the earliest of the largest so it is reproducible.
+	events := make([]int32, 0, len(ba.eventDamages))
+	for event := range ba.eventDamages {
+		events = append(events, event)
+	}
+	sort.Slice(events, func(i int, j int) bool { return events[i] < events[j] })
+	//a dry block has no driving event and reports event zero.
+	eventDamages := make([]EventDamage, len(events))
+	for i, event := range events {
+		ed := ba.eventDamages[event]
+		if i == 0 || ed.TotalDamage > summary.DrivingEvent.Value {
+			summary.DrivingEvent = EventValue{EventNumber: event, Value: ed.TotalDamage}
+		}
+		eventDamages[i] = *ed
+	}
+	ba.eventDamages = nil
+	ba.totals[ba.currentBlock] = summary.TotalDamage
+	ba.watershed = append(ba.watershed, summary)
+	if ba.eventHandler != nil {
+		err := ba.eventHandler(eventDamages)
+		if err != nil {
+			return err
+		}
+	}
+	if ba.blockHandler != nil {
+		results := make([]ConsequencesBlockResult, len(fdids))
+		for i, fdid := range fdids {
+			results[i] = ba.current[fdid].toBlockResult(fdid)
+		}
+		err := ba.blockHandler(ba.currentBlock, results)
+		if err != nil {
+			return err
+		}
+	}
+	if ba.spill && len(fdids) > 0 {
+		err := ba.writeRun(fdids)
+		if err != nil {
+			return err
+		}
+	}
+	ba.current = make(map[string]*structureBlock)
+	return nil
+}
+
+// Blocks returns the block indices that were begun, including dry blocks, in the order they were added.
+func (ba *BlockAccumulator) Blocks() []int32 {
+	return ba.blocks
+}
+
+// BlockTotals returns the sum of the reduced total damage across all structures for each completed block.
+func (ba *BlockAccumulator) BlockTotals() map[int32]float64 {
+	return ba.totals
+}
+
+// WatershedBlockTotals returns the watershed summary of each completed block in the order the blocks were added.
+func (ba *BlockAccumulator) WatershedBlockTotals() []WatershedBlockTotal {
+	return ba.watershed
+}
+
+// EachStructure flushes the current block and merges the spilled runs, yielding every structure's block values in fd_id order.
+// every structure has one value per block, zero where it was dry, sorted largest to smallest.
+func (ba *BlockAccumulator) EachStructure(yield func(result ConsequencesFrequencyResult) error) error {
+	if !ba.spill {
+		return errors.New("block accumulator requires a spill directory to provide structure results")
+	}
+	err := ba.Flush()
+	if err != nil {
+		return err
+	}
+	//reduce the number of runs until they can all be opened at once.
+	for len(ba.runs) > maxOpenSpillRuns {
+		merged := make([]string, 0)
+		for start := 0; start < len(ba.runs); start += maxOpenSpillRuns {
+			end := min(start+maxOpenSpillRuns, len(ba.runs))
+			run, err := ba.mergeRuns(ba.runs[start:end])
+			if err != nil {
+				return err
+			}
+			merged = append(merged, run)
+		}
+		ba.runs = merged
+	}
+	m, err := openRunMerger(ba.runs)
+	if err != nil {
+		return err
+	}
+	defer m.close()
+	var result ConsequencesFrequencyResult
+	started := false
+	for {
+		record, err := m.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if started && record.fdid != result.Fdid {
+			result = ba.zeroFill(result)
+			sortFrequencyResult(result)
+			err = yield(result)
+			if err != nil {
+				return err
+			}
+			started = false
+		}
+		if !started {
+			result = ConsequencesFrequencyResult{Fdid: record.fdid, X: record.X, Y: record.Y, DamageCategory: record.damageCategory, OccupancyType: record.occupancyType}
+			started = true
+		}
+		result.StructureDamage = append(result.StructureDamage, record.blockEventValue(0))
+		result.ContentDamage = append(result.ContentDamage, record.blockEventValue(1))
+		result.TotalDamage = append(result.TotalDamage, record.blockEventValue(2))
+		result.Depth = append(result.Depth, record.blockEventValue(3))
+		result.Velocity = append(result.Velocity, record.blockEventValue(4))
+		result.Duration = append(result.Duration, record.blockEventValue(5))
+		result.PopulationAtRisk = append(result.PopulationAtRisk, record.blockEventValue(6))
+		result.LifeLoss = append(result.LifeLoss, record.blockEventValue(7))
+	}
+	if started {
+		result = ba.zeroFill(result)
+		sortFrequencyResult(result)
+		return yield(result)
+	}
+	return nil
+}
+
+// zeroFill adds a zero value for every block in which the structure had no result so each structure has a value for every block.
+func (ba *BlockAccumulator) zeroFill(result ConsequencesFrequencyResult) ConsequencesFrequencyResult {
+	result.ResultBlocks = len(result.TotalDamage)
+	if len(result.TotalDamage) == len(ba.blocks) {
+		return result
+	}
+	wet := make(map[int32]bool, len(result.TotalDamage))
+	for _, v := range result.TotalDamage {
+		wet[v.BlockNumber] = true
+	}
+	for _, b := range ba.blocks {
+		if wet[b] {
+			continue
+		}
+		dry := BlockEventValue{BlockNumber: b}
+		result.StructureDamage = append(result.StructureDamage, dry)
+		result.ContentDamage = append(result.ContentDamage, dry)
+		result.TotalDamage = append(result.TotalDamage, dry)
+		result.Depth = append(result.Depth, dry)
+		result.Velocity = append(result.Velocity, dry)
+		result.Duration = append(result.Duration, dry)
+		result.PopulationAtRisk = append(result.PopulationAtRisk, dry)
+		result.LifeLoss = append(result.LifeLoss, dry)
+	}
+	return result
+}
+
+// Close removes any spilled runs from disk.
+func (ba *BlockAccumulator) Close() error {
+	if !ba.spill {
+		return nil
+	}
+	return os.RemoveAll(ba.SpillDirectory)
+}
+
+// spillRecord is the fixed size portion of a structure's block result written to a run.
+type spillRecord struct {
+	X      float64
+	Y      float64
+	Block  int32
+	Events [8]int32
+	Values [8]float64
+}
+type runRecord struct {
+	fdid           string
+	damageCategory string
+	occupancyType  string
+	spillRecord
+}
+
+func (r runRecord) blockEventValue(i int) BlockEventValue {
+	return BlockEventValue{BlockNumber: r.Block, EventNumber: r.Events[i], Value: r.Values[i]}
+}
+func writeRunString(w io.Writer, s string) error {
+	err := binary.Write(w, binary.LittleEndian, uint16(len(s)))
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, s)
+	return err
+}
+func readRunString(r io.Reader) (string, error) {
+	var n uint16
+	err := binary.Read(r, binary.LittleEndian, &n)
+	if err != nil {
+		return "", err
+	}
+	b := make([]byte, n)
+	_, err = io.ReadFull(r, b)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return string(b), err
+}
+func writeRunRecord(w io.Writer, r runRecord) error {
+	for _, s := range []string{r.fdid, r.damageCategory, r.occupancyType} {
+		err := writeRunString(w, s)
+		if err != nil {
+			return err
+		}
+	}
+	return binary.Write(w, binary.LittleEndian, r.spillRecord)
+}
+
+// readRunRecord returns io.EOF only at a clean record boundary.
+func readRunRecord(r io.Reader) (runRecord, error) {
+	fdid, err := readRunString(r)
+	if err != nil {
+		return runRecord{}, err
+	}
+	record := runRecord{fdid: fdid}
+	record.damageCategory, err = readRunString(r)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return runRecord{}, err
+	}
+	record.occupancyType, err = readRunString(r)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return runRecord{}, err
+	}
+	err = binary.Read(r, binary.LittleEndian, &record.spillRecord)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return record, err
+}
+
+// writeRun writes the current block to disk sorted by fd_id.
+func (ba *BlockAccumulator) writeRun(fdids []string) error {
+	path := fmt.Sprintf("%v/block_%v.run", ba.SpillDirectory, ba.currentBlock)
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	w := bufio.NewWriter(file)
+	for _, fdid := range fdids {
+		s := ba.current[fdid]
+		record := runRecord{fdid: fdid, damageCategory: s.damageCategory, occupancyType: s.occupancyType, spillRecord: spillRecord{
+			X:      s.x,
+			Y:      s.y,
+			Block:  ba.currentBlock,
+			Events: [8]int32{s.structureDamage.EventNumber, s.contentDamage.EventNumber, s.totalDamage.EventNumber, s.depth.EventNumber, s.velocity.EventNumber, s.duration.EventNumber, s.populationAtRisk.EventNumber, s.lifeLoss.EventNumber},
+			Values: [8]float64{s.structureDamage.Value, s.contentDamage.Value, s.totalDamage.Value, s.depth.Value, s.velocity.Value, s.duration.Value, s.populationAtRisk.Value, s.lifeLoss.Value},
+		}}
+		err = writeRunRecord(w, record)
+		if err != nil {
+			return err
+		}
+	}
+	ba.runs = append(ba.runs, path)
+	return w.Flush()
+}
+
+// mergeRuns combines a set of runs into a single run sorted by fd_id and removes the inputs.
+func (ba *BlockAccumulator) mergeRuns(runs []string) (string, error) {
+	file, err := os.CreateTemp(ba.SpillDirectory, "merged-*.run")
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	m, err := openRunMerger(runs)
+	if err != nil {
+		return "", err
+	}
+	defer m.close()
+	w := bufio.NewWriter(file)
+	for {
+		record, err := m.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		err = writeRunRecord(w, record)
+		if err != nil {
+			return "", err
+		}
+	}
+	for _, run := range runs {
+		os.Remove(run)
+	}
+	return file.Name(), w.Flush()
+}
+
+// runMerger reads a set of runs sorted by fd_id as a single sorted stream.
+type runMerger struct {
+	files   []*os.File
+	readers []*bufio.Reader
+	heads   runHeap
+}
+type runHead struct {
+	record runRecord
+	run    int
+}
+type runHeap []runHead
+
+func (h runHeap) Len() int { return len(h) }
+func (h runHeap) Less(i, j int) bool {
+	if h[i].record.fdid == h[j].record.fdid {
+		return h[i].record.Block < h[j].record.Block
+	}
+	return h[i].record.fdid < h[j].record.fdid
+}
+func (h runHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *runHeap) Push(x interface{}) { *h = append(*h, x.(runHead)) }
+func (h *runHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[0 : n-1]
+	return x
+}
+
+func openRunMerger(runs []string) (*runMerger, error) {
+	m := &runMerger{}
+	for i, run := range runs {
+		file, err := os.Open(run)
+		if err != nil {
+			m.close()
+			return nil, err
+		}
+		m.files = append(m.files, file)
+		m.readers = append(m.readers, bufio.NewReader(file))
+		record, err := readRunRecord(m.readers[i])
+		if err == io.EOF {
+			continue
+		}
+		if err != nil {
+			m.close()
+			return nil, err
+		}
+		m.heads = append(m.heads, runHead{record: record, run: i})
+	}
+	heap.Init(&m.heads)
+	return m, nil
+}
+func (m *runMerger) next() (runRecord, error) {
+	if len(m.heads) == 0 {
+		return runRecord{}, io.EOF
+	}
+	head := m.heads[0]
+	record, err := readRunRecord(m.readers[head.run])
+	if err == io.EOF {
+		heap.Pop(&m.heads)
+	} else if err != nil {
+		return runRecord{}, err
+	} else {
+		m.heads[0] = runHead{record: record, run: head.run}
+		heap.Fix(&m.heads, 0)
+	}
+	return head.record, nil
+}
+func (m *runMerger) close() {
+	for _, f := range m.files {
+		f.Close()
+	}
+}
+
+func sortFrequencyResult(result ConsequencesFrequencyResult) {
+	sortBlockEventValues(result.StructureDamage)
+	sortBlockEventValues(result.ContentDamage)
+	sortBlockEventValues(result.TotalDamage)
+	sortBlockEventValues(result.Depth)
+	sortBlockEventValues(result.Velocity)
+	sortBlockEventValues(result.Duration)
+	sortBlockEventValues(result.PopulationAtRisk)
+	sortBlockEventValues(result.LifeLoss)
+}
+
+// sortBlockEventValues sorts largest to smallest, ties are broken by block number to keep outputs stable.
+func sortBlockEventValues(values []BlockEventValue) {
+	sort.SliceStable(values, func(i int, j int) bool {
+		if values[i].Value == values[j].Value {
+			return values[i].BlockNumber < values[j].BlockNumber
+		}
+		return values[i].Value > values[j].Value
+	})
+}
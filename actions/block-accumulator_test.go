@@ -0,0 +1,300 @@
+package actions
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const syntheticBlockFile = `[
+	{"realization_index": 1, "block_index": 1, "block_event_count": 3, "block_event_start": 1, "block_event_end": 3},
+	{"realization_index": 1, "block_index": 2, "block_event_count": 2, "block_event_start": 4, "block_event_end": 5},
+	{"realization_index": 1, "block_index": 3, "block_event_count": 1, "block_event_start": 6, "block_event_end": 6},
+	{"realization_index": 2, "block_index": 1, "block_event_count": 1, "block_event_start": 7, "block_event_end": 7}
+]`
+
+// syntheticStructureDamage holds the structure damage of each structure for each event, a missing entry means the structure was dry.
+var syntheticStructureDamage = map[int64]map[string]float64{
+	1: {"a": 10, "b": 5},
+	2: {"a": 30},
+	3: {"a": 20, "b": 0},
+	4: {"b": 40},
+	5: {"a": 1, "b": 15},
+	6: {"a": 7},
+	7: {"a": 1000},
+}
+
+var syntheticDamageCategory = map[string]string{"a": "RES", "b": "COM"}
+var syntheticOccupancyType = map[string]string{"a": "RES1-1SNB", "b": "COM1"}
+
+// syntheticAccumulation collects everything the accumulator emits for the synthetic realization.
+type syntheticAccumulation struct {
+	accumulator  *BlockAccumulator
+	blockResults map[int32]map[string]ConsequencesBlockResult
+	events       []EventDamage
+}
+
+func (sa syntheticAccumulation) frequencyResults(t *testing.T) map[string]ConsequencesFrequencyResult {
+	results := make(map[string]ConsequencesFrequencyResult)
+	previous := ""
+	err := sa.accumulator.EachStructure(func(r ConsequencesFrequencyResult) error {
+		if r.Fdid <= previous {
+			t.Errorf("expected structures in fd_id order, got %v after %v", r.Fdid, previous)
+		}
+		previous = r.Fdid
+		results[r.Fdid] = r
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return results
+}
+
+func accumulateSyntheticBlocks(t *testing.T, statistic BlockStatistic) syntheticAccumulation {
+	path := filepath.Join(t.TempDir(), "blockfile.json")
+	err := os.WriteFile(path, []byte(syntheticBlockFile), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks, err := readBlocks(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accumulator := InitBlockAccumulator(statistic)
+	err = accumulator.SetSpillDirectory(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { accumulator.Close() })
+	blockResults := make(map[int32]map[string]ConsequencesBlockResult)
+	events := make([]EventDamage, 0)
+	accumulator.SetEventHandler(func(e []EventDamage) error {
+		events = append(events, e...)
+		return nil
+	})
+	accumulator.SetBlockHandler(func(block int32, results []ConsequencesBlockResult) error {
+		blockResults[block] = make(map[string]ConsequencesBlockResult)
+		for _, r := range results {
+			blockResults[block][r.Fdid] = r
+		}
+		return nil
+	})
+	for _, b := range blocks {
+		if b.RealizationIndex != 1 {
+			continue
+		}
+		for e := b.BlockEventStart; e <= b.BlockEventEnd; e++ {
+			for _, fdid := range []string{"a", "b"} {
+				sd, ok := syntheticStructureDamage[e][fdid]
+				if !ok {
+					continue
+				}
+				err = accumulator.Add(int32(b.BlockIndex), ConsequenceResult{
+					EventNumber:    int32(e),
+					BlockNumber:    int32(b.BlockIndex),
+					Fdid:           fdid,
+					DamageCategory: syntheticDamageCategory[fdid],
+					OccupancyType:  syntheticOccupancyType[fdid],
+					StructDamage:   sd,
+					ContentDamage:  sd / 2,
+					Depth:          sd / 10,
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+	}
+	err = accumulator.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return syntheticAccumulation{accumulator: accumulator, blockResults: blockResults, events: events}
+}
+
+func Test_BlockAccumulatorMaximum(t *testing.T) {
+	accumulation := accumulateSyntheticBlocks(t, BlockMaximum)
+	results := accumulation.blockResults
+	if len(results) != 3 {
+		t.Fatalf("expected 3 blocks, got %v", len(results))
+	}
+	a := results[1]["a"]
+	if a.StructureDamage.Value != 30 || a.StructureDamage.EventNumber != 2 {
+		t.Errorf("expected block 1 maximum of 30 from event 2, got %v from event %v", a.StructureDamage.Value, a.StructureDamage.EventNumber)
+	}
+	if a.TotalDamage.Value != 45 {
+		t.Errorf("expected block 1 total damage maximum of 45, got %v", a.TotalDamage.Value)
+	}
+	b := results[2]["b"]
+	if b.Depth.Value != 4 || b.Depth.EventNumber != 4 {
+		t.Errorf("expected block 2 depth maximum of 4 from event 4, got %v from event %v", b.Depth.Value, b.Depth.EventNumber)
+	}
+	if _, ok := results[3]["b"]; ok {
+		t.Errorf("structure b was dry in block 3 and should not have a result")
+	}
+	totals := accumulation.accumulator.BlockTotals()
+	if totals[1] != 45+7.5 || totals[2] != 1.5+60 || totals[3] != 10.5 {
+		t.Errorf("unexpected block totals %v", totals)
+	}
+}
+
+func Test_BlockAccumulatorSum(t *testing.T) {
+	results := accumulateSyntheticBlocks(t, BlockSum).blockResults
+	a := results[1]["a"]
+	if a.StructureDamage.Value != 60 {
+		t.Errorf("expected block 1 sum of 60, got %v", a.StructureDamage.Value)
+	}
+	if a.StructureDamage.EventNumber != 2 {
+		t.Errorf("expected the largest event of block 1 to be 2, got %v", a.StructureDamage.EventNumber)
+	}
+	b := results[2]["b"]
+	if b.StructureDamage.Value != 55 {
+		t.Errorf("expected block 2 sum of 55, got %v", b.StructureDamage.Value)
+	}
+}
+
+func Test_BlockAccumulatorCountWet(t *testing.T) {
+	results := accumulateSyntheticBlocks(t, BlockCountWet).blockResults
+	if results[1]["a"].StructureDamage.Value != 3 {
+		t.Errorf("expected 3 wet events for a in block 1, got %v", results[1]["a"].StructureDamage.Value)
+	}
+	if results[1]["b"].StructureDamage.Value != 1 {
+		t.Errorf("expected 1 wet event for b in block 1, got %v", results[1]["b"].StructureDamage.Value)
+	}
+	if results[2]["b"].StructureDamage.Value != 2 {
+		t.Errorf("expected 2 wet events for b in block 2, got %v", results[2]["b"].StructureDamage.Value)
+	}
+}
+
+func Test_BlockAccumulatorFrequencyResults(t *testing.T) {
+	results := accumulateSyntheticBlocks(t, BlockMaximum).frequencyResults(t)
+	a := results["a"]
+	if len(a.StructureDamage) != 3 {
+		t.Fatalf("expected a to have 3 block maxima, got %v", len(a.StructureDamage))
+	}
+	expected := []BlockEventValue{{BlockNumber: 1, EventNumber: 2, Value: 30}, {BlockNumber: 3, EventNumber: 6, Value: 7}, {BlockNumber: 2, EventNumber: 5, Value: 1}}
+	for i, e := range expected {
+		if a.StructureDamage[i] != e {
+			t.Errorf("expected ordinate %v to be %v, got %v", i, e, a.StructureDamage[i])
+		}
+	}
+	//b was dry in block 3 and is zero filled.
+	b := results["b"].TotalDamage
+	if len(b) != 3 || b[2] != (BlockEventValue{BlockNumber: 3}) {
+		t.Errorf("expected b to have 3 block maxima ending with a dry block 3, got %v", b)
+	}
+}
+
+func Test_BlockAccumulatorMergesRunsInPasses(t *testing.T) {
+	defer func(open int) { maxOpenSpillRuns = open }(maxOpenSpillRuns)
+	maxOpenSpillRuns = 2
+	accumulator := InitBlockAccumulator(BlockMaximum)
+	err := accumulator.SetSpillDirectory(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer accumulator.Close()
+	//structure s is wet in every block with damage equal to the block index, t only in even blocks.
+	for b := int32(1); b <= 7; b++ {
+		accumulator.Add(b, ConsequenceResult{EventNumber: b * 10, Fdid: "s", StructDamage: float64(b)})
+		if b%2 == 0 {
+			accumulator.Add(b, ConsequenceResult{EventNumber: b * 10, Fdid: "t", StructDamage: 100})
+		}
+	}
+	count := 0
+	err = accumulator.EachStructure(func(r ConsequencesFrequencyResult) error {
+		count++
+		switch r.Fdid {
+		case "s":
+			if len(r.StructureDamage) != 7 {
+				t.Fatalf("expected 7 blocks for s, got %v", len(r.StructureDamage))
+			}
+			for i, v := range r.StructureDamage {
+				if v.Value != float64(7-i) || v.BlockNumber != int32(7-i) || v.EventNumber != int32(70-10*i) {
+					t.Errorf("unexpected ordinate %v for s: %v", i, v)
+				}
+			}
+		case "t":
+			if len(r.StructureDamage) != 7 || r.StructureDamage[2].Value != 100 || r.StructureDamage[3].Value != 0 {
+				t.Errorf("expected 3 wet and 4 dry blocks for t, got %v", r.StructureDamage)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("expected 2 structures, got %v", count)
+	}
+}
+
+func Test_BlockAccumulatorWatershedCurve(t *testing.T) {
+	accumulation := accumulateSyntheticBlocks(t, BlockMaximum)
+	curve := buildWatershedCurve(1, accumulation.accumulator.WatershedBlockTotals(), 3, Weibull)
+	expected := []WatershedCurveOrdinate{
+		{Rank: 1, AEP: 0.25, BlockNumber: 2, EventNumber: 4, TotalDamage: 61.5},
+		{Rank: 2, AEP: 0.5, BlockNumber: 1, EventNumber: 2, TotalDamage: 52.5},
+		{Rank: 3, AEP: 0.75, BlockNumber: 3, EventNumber: 6, TotalDamage: 10.5},
+	}
+	if len(curve.Ordinates) != len(expected) {
+		t.Fatalf("expected %v ordinates, got %v", len(expected), len(curve.Ordinates))
+	}
+	for i, e := range expected {
+		o := curve.Ordinates[i]
+		if o.Rank != e.Rank || o.AEP != e.AEP || o.BlockNumber != e.BlockNumber || o.EventNumber != e.EventNumber || o.TotalDamage != e.TotalDamage {
+			t.Errorf("expected ordinate %v to be %v, got %v", i, e, o)
+		}
+	}
+	if curve.Ordinates[0].CategoryDamage["COM"] != 60 || curve.Ordinates[0].CategoryDamage["RES"] != 1.5 {
+		t.Errorf("unexpected category damage for block 2 %v", curve.Ordinates[0].CategoryDamage)
+	}
+	if curve.AAL != 41.5 || curve.CategoryAAL["RES"] != 19 || curve.CategoryAAL["COM"] != 22.5 {
+		t.Errorf("unexpected aal %v by category %v", curve.AAL, curve.CategoryAAL)
+	}
+	sb := strings.Builder{}
+	err := curve.WriteCSV(&sb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(sb.String(), "\n")
+	if lines[0] != "rank,aep,block_id,event_id,missing_events,total_damage,population_at_risk,life_loss,COM,RES" || lines[1] != "1,0.25000,2,4,0,61.50,0.00,0.00,60.00,1.50" {
+		t.Errorf("unexpected csv %v", sb.String())
+	}
+}
+
+func Test_WatershedCurveCSVWithoutCategories(t *testing.T) {
+	totals := []WatershedBlockTotal{
+		{BlockNumber: 1, TotalDamage: 5, CategoryDamage: map[string]float64{"": 5}},
+		{BlockNumber: 2, TotalDamage: 3, CategoryDamage: map[string]float64{"": 2, "RES": 1}},
+	}
+	sb := strings.Builder{}
+	err := buildWatershedCurve(1, totals[:1], 1, Weibull).WriteCSV(&sb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header := strings.Split(sb.String(), "\n")[0]; header != "rank,aep,block_id,event_id,missing_events,total_damage,population_at_risk,life_loss" {
+		t.Errorf("expected no category columns without damage categories, got %v", header)
+	}
+	sb.Reset()
+	err = buildWatershedCurve(1, totals, 2, Weibull).WriteCSV(&sb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header := strings.Split(sb.String(), "\n")[0]; !strings.HasSuffix(header, ",unknown,RES") {
+		t.Errorf("expected structures without a damage category to be labelled unknown, got %v", header)
+	}
+}
+
+func Test_ParseBlockStatistic(t *testing.T) {
+	s, err := ParseBlockStatistic("")
+	if err != nil || s != BlockMaximum {
+		t.Errorf("expected an empty statistic to default to max")
+	}
+	_, err = ParseBlockStatistic("median")
+	if err == nil {
+		t.Errorf("expected median to be rejected")
+	}
+}
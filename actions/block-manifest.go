@@ -0,0 +1,135 @@
+package actions
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ValidationMode controls how problems with the block file and missing event outputs are handled.
+type ValidationMode string
+
+const (
+	StrictValidation  ValidationMode = "strict"  //any problem fails the action
+	LenientValidation ValidationMode = "lenient" //problems are recorded in the validation report and the action continues
+)
+
+const (
+	validationModeKey           string = "validationMode"           //optional, strict or lenient. defaults to lenient.
+	validationReportFilePathKey string = "validationReportFilePath" //optional, defaults to the realization result file path with a _validation.json suffix.
+)
+
+// ParseValidationMode converts an action attribute into a ValidationMode, an empty string is treated as lenient.
+func ParseValidationMode(s string) (ValidationMode, error) {
+	switch ValidationMode(strings.ToLower(strings.TrimSpace(s))) {
+	case "", LenientValidation:
+		return LenientValidation, nil
+	case StrictValidation:
+		return StrictValidation, nil
+	default:
+		return LenientValidation, errors.New("unrecognized validation mode " + s + ", expected strict or lenient")
+	}
+}
+
+// MissingEvent is an event in the block file without a readable compute output.
+type MissingEvent struct {
+	BlockNumber int32  `json:"block_id"`
+	EventNumber int64  `json:"event_id"`
+	Reason      string `json:"reason"`
+}
+
+// ManifestReport records the problems found with a realization's block file and event outputs.
+type ManifestReport struct {
+	Realization   int            `json:"realization"`
+	Mode          ValidationMode `json:"mode"`
+	BlockCount    int            `json:"block_count"`
+	EventCount    int64          `json:"event_count"`
+	Issues        []string       `json:"issues"`
+	MissingEvents []MissingEvent `json:"missing_events"`
+	missing       map[int32]int
+}
+
+// validateBlockManifest checks that the realization's blocks are present, that event ranges are contiguous,
+// and that each block's event count agrees with its range. in strict mode any issue is returned as an error.
+func validateBlockManifest(blocks Blocks, realizationNumber int, mode ValidationMode) (*ManifestReport, error) {
+	report := &ManifestReport{Realization: realizationNumber, Mode: mode, Issues: make([]string, 0), MissingEvents: make([]MissingEvent, 0), missing: make(map[int32]int)}
+	var previous *Block
+	for i := range blocks {
+		b := blocks[i]
+		if b.RealizationIndex != realizationNumber {
+			continue
+		}
+		report.BlockCount++
+		span := b.BlockEventEnd - b.BlockEventStart + 1
+		if span < 0 {
+			report.Issues = append(report.Issues, fmt.Sprintf("block %v ends at event %v before it starts at event %v", b.BlockIndex, b.BlockEventEnd, b.BlockEventStart))
+		} else {
+			report.EventCount += span
+			if int64(b.BlockEventCount) != span {
+				report.Issues = append(report.Issues, fmt.Sprintf("block %v has an event count of %v but spans %v events from %v to %v", b.BlockIndex, b.BlockEventCount, span, b.BlockEventStart, b.BlockEventEnd))
+			}
+		}
+		if previous != nil {
+			if b.BlockIndex != previous.BlockIndex+1 {
+				report.Issues = append(report.Issues, fmt.Sprintf("block %v follows block %v", b.BlockIndex, previous.BlockIndex))
+			}
+			if b.BlockEventStart != previous.BlockEventEnd+1 {
+				report.Issues = append(report.Issues, fmt.Sprintf("block %v starts at event %v but block %v ends at event %v", b.BlockIndex, b.BlockEventStart, previous.BlockIndex, previous.BlockEventEnd))
+			}
+		}
+		previous = &blocks[i]
+	}
+	if report.BlockCount == 0 {
+		report.Issues = append(report.Issues, fmt.Sprintf("realization %v has no blocks", realizationNumber))
+	}
+	if mode == StrictValidation && len(report.Issues) > 0 {
+		return report, errors.New("invalid block file: " + strings.Join(report.Issues, "; "))
+	}
+	return report, nil
+}
+
+// recordMissing notes an event without a readable output, in strict mode the event is returned as an error.
+func (mr *ManifestReport) recordMissing(block int32, event int64, reason error) error {
+	if mr == nil {
+		log.Printf("skipping event %v of block %v: %v\n", event, block, reason)
+		return nil
+	}
+	mr.MissingEvents = append(mr.MissingEvents, MissingEvent{BlockNumber: block, EventNumber: event, Reason: reason.Error()})
+	mr.missing[block]++
+	if mr.Mode == StrictValidation {
+		return fmt.Errorf("event %v of block %v is missing: %w", event, block, reason)
+	}
+	log.Printf("skipping event %v of block %v: %v\n", event, block, reason)
+	return nil
+}
+
+// MissingCount returns the number of missing events in a block.
+func (mr *ManifestReport) MissingCount(block int32) int {
+	if mr == nil {
+		return 0
+	}
+	return mr.missing[block]
+}
+
+// Write saves the report as json, missing events are sorted so reports can be compared between runs.
+func (mr *ManifestReport) Write(path string) error {
+	sort.Slice(mr.MissingEvents, func(i int, j int) bool { return mr.MissingEvents[i].EventNumber < mr.MissingEvents[j].EventNumber })
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(mr)
+}
+
+// defaultValidationReportPath places the report next to the realization result.
+func defaultValidationReportPath(realizationResultFilePath string) string {
+	return strings.TrimSuffix(realizationResultFilePath, filepath.Ext(realizationResultFilePath)) + "_validation.json"
+}
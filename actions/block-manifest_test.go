@@ -0,0 +1,68 @@
+package actions
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_ValidateBlockManifest(t *testing.T) {
+	report, err := validateBlockManifest(syntheticBlocks(), 1, StrictValidation)
+	if err != nil {
+		t.Fatalf("expected contiguous blocks to validate, got %v", err)
+	}
+	if report.BlockCount != 5 || report.EventCount != 30 {
+		t.Errorf("expected 5 blocks and 30 events, got %v and %v", report.BlockCount, report.EventCount)
+	}
+	blocks := syntheticBlocks()
+	blocks[1].BlockEventStart++   //gap between blocks 1 and 2, and a count mismatch in block 2
+	blocks[3].BlockEventCount = 4 //count mismatch in block 4
+	report, err = validateBlockManifest(blocks, 1, LenientValidation)
+	if err != nil {
+		t.Fatalf("expected lenient validation to continue, got %v", err)
+	}
+	if len(report.Issues) != 3 {
+		t.Errorf("expected 3 issues, got %v", report.Issues)
+	}
+	_, err = validateBlockManifest(blocks, 1, StrictValidation)
+	if err == nil {
+		t.Errorf("expected strict validation to fail")
+	}
+	_, err = validateBlockManifest(syntheticBlocks(), 9, LenientValidation)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_MissingEventsByMode(t *testing.T) {
+	reader := &fakeEventReader{missing: map[int64]bool{2: true, 3: true, 20: true}}
+	report, _ := validateBlockManifest(syntheticBlocks(), 1, LenientValidation)
+	err := readRealizationEvents(syntheticBlocks(), 1, "events/%v.gpkg", 4, reader.read, report, func(e EventResults) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.MissingCount(1) != 2 || report.MissingCount(4) != 1 || report.MissingCount(2) != 0 {
+		t.Errorf("unexpected missing counts %v", report.MissingEvents)
+	}
+	path := filepath.Join(t.TempDir(), "report.json")
+	err = report.Write(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := os.ReadFile(path)
+	var written ManifestReport
+	err = json.Unmarshal(b, &written)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(written.MissingEvents) != 3 || written.MissingEvents[0].EventNumber != 2 || written.MissingEvents[2].BlockNumber != 4 {
+		t.Errorf("unexpected report %v", string(b))
+	}
+	report, _ = validateBlockManifest(syntheticBlocks(), 1, StrictValidation)
+	err = readRealizationEvents(syntheticBlocks(), 1, "events/%v.gpkg", 4, reader.read, report, func(e EventResults) error { return nil })
+	if !errors.Is(err, errEventResultNotFound) {
+		t.Errorf("expected strict mode to fail on a missing event, got %v", err)
+	}
+}
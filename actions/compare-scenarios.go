@@ -0,0 +1,275 @@
+package actions
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/USACE/go-consequences/consequences"
+	"github.com/USACE/go-consequences/resultswriters"
+	"github.com/dewberry/gdal"
+	"github.com/usace-cloud-compute/cc-go-sdk"
+)
+
+const (
+	baselineFrequencyFilePathKey    string = "baselineFrequencyFilePath"    //summarize-outputs-to-frequency csv without the project
+	alternativeFrequencyFilePathKey string = "alternativeFrequencyFilePath" //summarize-outputs-to-frequency csv with the project
+	comparisonCsvFilePathKey        string = "comparisonCsvFilePath"
+	comparisonSpatialFilePathKey    string = "comparisonSpatialFilePath"
+	comparisonSummaryFilePathKey    string = "comparisonSummaryFilePath"
+	spatialReferenceFilePathKey     string = "spatialReferenceFilePath" //any layer in the projection of the structures, e.g. the baseline spatial frequency output
+	spatialReferenceDriverKey       string = "spatialReferenceDriver"
+	spatialReferenceTableNameKey    string = "spatialReferenceTableName"
+	compareScenariosActionName      string = "compare-scenarios"
+	comparisonSpatialOutputTable    string = "comparison"
+)
+
+func init() {
+	cc.ActionRegistry.RegisterAction(compareScenariosActionName, &CompareScenariosAction{})
+}
+
+// CompareScenariosAction computes the aal reduction and damages avoided between a without-project and a with-project frequency output.
+type CompareScenariosAction struct {
+	cc.ActionRunnerBase
+}
+
+// ScenarioComparison is the difference between the baseline and alternative for one structure.
+type ScenarioComparison struct {
+	Fdid               string
+	X                  float64
+	Y                  float64
+	BaselineTAAL       float64
+	AlternativeTAAL    float64
+	AALReduction       float64
+	BaselineDamages    []float64 //total damage at each return period
+	AlternativeDamages []float64
+	DamagesAvoided     []float64
+	Worse              bool //the alternative increased the structure's aal
+}
+
+// ScenarioSummary totals the comparison across all structures, damages by return period come from the watershed curves.
+type ScenarioSummary struct {
+	BaselineAAL        float64
+	AlternativeAAL     float64
+	BaselineDamages    []float64
+	AlternativeDamages []float64
+	StructureCount     int
+	WorseCount         int
+}
+
+// compareScenarios merges the baseline and alternative by fd_id, a structure missing from one scenario was never wet in it and contributes zeros.
+func compareScenarios(baseline *frequencyFileReader, alternative *frequencyFileReader, returnPeriods []float64, plottingPosition PlottingPosition, yield func(c ScenarioComparison) error) (ScenarioSummary, error) {
+	readers := []*frequencyFileReader{baseline, alternative}
+	ordinals := make([][]int, len(readers))
+	for i, r := range readers {
+		ordinals[i] = make([]int, len(returnPeriods))
+		for j, rp := range returnPeriods {
+			o, ok := plottingPosition.Ordinal(rp, r.BlockCount)
+			if !ok {
+				log.Printf("the %v return period is rarer than %v blocks can support, reporting zero\n", rp, r.BlockCount)
+			}
+			ordinals[i][j] = o
+		}
+	}
+	summary := ScenarioSummary{}
+	blockTotals := []map[int32]float64{make(map[int32]float64), make(map[int32]float64)}
+	for {
+		fdid := ""
+		var x, y float64
+		for _, r := range readers {
+			if r.err != nil {
+				return summary, r.err
+			}
+			if r.next != nil && (fdid == "" || r.next.Fdid < fdid) {
+				fdid, x, y = r.next.Fdid, r.next.X, r.next.Y
+			}
+		}
+		if fdid == "" {
+			break
+		}
+		taal := make([]float64, len(readers))
+		damages := [][]float64{make([]float64, len(returnPeriods)), make([]float64, len(returnPeriods))}
+		for i, r := range readers {
+			s := r.next
+			if s == nil || s.Fdid != fdid {
+				continue
+			}
+			taal[i] = s.TAAL
+			for j, o := range ordinals[i] {
+				damages[i][j] = valueAtOrdinal(s.TotalDamage, o)
+			}
+			for _, v := range s.TotalDamage {
+				blockTotals[i][v.BlockNumber] += v.Value
+			}
+			r.advance()
+		}
+		c := ScenarioComparison{
+			Fdid:               fdid,
+			X:                  x,
+			Y:                  y,
+			BaselineTAAL:       taal[0],
+			AlternativeTAAL:    taal[1],
+			AALReduction:       taal[0] - taal[1],
+			BaselineDamages:    damages[0],
+			AlternativeDamages: damages[1],
+			DamagesAvoided:     make([]float64, len(returnPeriods)),
+			Worse:              taal[1] > taal[0],
+		}
+		for j := range returnPeriods {
+			c.DamagesAvoided[j] = damages[0][j] - damages[1][j]
+		}
+		summary.BaselineAAL += c.BaselineTAAL
+		summary.AlternativeAAL += c.AlternativeTAAL
+		summary.StructureCount++
+		if c.Worse {
+			summary.WorseCount++
+		}
+		err := yield(c)
+		if err != nil {
+			return summary, err
+		}
+	}
+	//the watershed curve of each scenario is its block totals sorted largest to smallest.
+	summary.BaselineDamages = make([]float64, len(returnPeriods))
+	summary.AlternativeDamages = make([]float64, len(returnPeriods))
+	for i, totals := range blockTotals {
+		curve := make([]BlockEventValue, 0, len(totals))
+		for b, v := range totals {
+			curve = append(curve, BlockEventValue{BlockNumber: b, Value: v})
+		}
+		sortBlockEventValues(curve)
+		for j, o := range ordinals[i] {
+			if i == 0 {
+				summary.BaselineDamages[j] = valueAtOrdinal(curve, o)
+			} else {
+				summary.AlternativeDamages[j] = valueAtOrdinal(curve, o)
+			}
+		}
+	}
+	return summary, nil
+}
+
+// comparisonHeaders returns the spatial column names, short enough for shapefile field names.
+func comparisonHeaders(returnPeriods []float64) []string {
+	headers := []string{"fd_id", "x", "y", "BaseTAAL", "AltTAAL", "AALRed", "Worse"}
+	for _, rp := range returnPeriods {
+		headers = append(headers, "B"+returnPeriodLabel(rp), "A"+returnPeriodLabel(rp), returnPeriodLabel(rp)+"Avd")
+	}
+	return headers
+}
+
+func writeComparisonCsvHeader(w *bufio.Writer, returnPeriods []float64) {
+	w.WriteString("fd_id,x,y,baseline_taal,alternative_taal,aal_reduction,worse")
+	for _, rp := range returnPeriods {
+		l := returnPeriodLabel(rp)
+		w.WriteString(fmt.Sprintf(",baseline_%v,alternative_%v,avoided_%v", l, l, l))
+	}
+	w.WriteString("\n")
+}
+
+func writeComparisonCsvRow(w *bufio.Writer, c ScenarioComparison) error {
+	w.WriteString(fmt.Sprintf("%v,%v,%v,%.2f,%.2f,%.2f,%v", c.Fdid, c.X, c.Y, c.BaselineTAAL, c.AlternativeTAAL, c.AALReduction, c.Worse))
+	for j := range c.DamagesAvoided {
+		w.WriteString(fmt.Sprintf(",%.2f,%.2f,%.2f", c.BaselineDamages[j], c.AlternativeDamages[j], c.DamagesAvoided[j]))
+	}
+	_, err := w.WriteString("\n")
+	return err
+}
+
+// writeScenarioSummary writes one row per metric with the baseline, alternative and reduction.
+func writeScenarioSummary(output io.Writer, returnPeriods []float64, summary ScenarioSummary) error {
+	w := bufio.NewWriter(output)
+	w.WriteString("metric,return_period,baseline,alternative,reduction\n")
+	w.WriteString(fmt.Sprintf("aal,,%.2f,%.2f,%.2f\n", summary.BaselineAAL, summary.AlternativeAAL, summary.BaselineAAL-summary.AlternativeAAL))
+	for j, rp := range returnPeriods {
+		w.WriteString(fmt.Sprintf("damage,%v,%.2f,%.2f,%.2f\n", rp, summary.BaselineDamages[j], summary.AlternativeDamages[j], summary.BaselineDamages[j]-summary.AlternativeDamages[j]))
+	}
+	w.WriteString(fmt.Sprintf("structures_worse,,,%v,\n", summary.WorseCount))
+	return w.Flush()
+}
+
+// readSpatialReference returns the projection of a layer as wkt.
+func readSpatialReference(path string, driver string, tablename string) (string, error) {
+	ds, ok := gdal.OGRDriverByName(driver).Open(path, int(gdal.ReadOnly))
+	if !ok {
+		return "", errors.New("error opening spatial reference layer " + path)
+	}
+	defer ds.Destroy()
+	return ds.LayerByName(tablename).SpatialReference().ToWKT()
+}
+
+func (ar *CompareScenariosAction) Run() error {
+	a := ar.Action
+	baselinePath := a.Attributes.GetStringOrFail(baselineFrequencyFilePathKey)
+	alternativePath := a.Attributes.GetStringOrFail(alternativeFrequencyFilePathKey)
+	csvFilePath := a.Attributes.GetStringOrFail(comparisonCsvFilePathKey)
+	spatialFilePath := a.Attributes.GetStringOrFail(comparisonSpatialFilePathKey)
+	summaryFilePath := a.Attributes.GetStringOrFail(comparisonSummaryFilePathKey)
+	spatialDriver := a.Attributes.GetStringOrFail(spatialOutputDriverKey)
+	returnPeriods, err := parseReturnPeriods(a.Attributes.GetStringOrDefault(returnPeriodsKey, defaultReturnPeriods))
+	if err != nil {
+		return err
+	}
+	plottingPosition, err := ParsePlottingPosition(a.Attributes.GetStringOrDefault(plottingPositionKey, string(Weibull)))
+	if err != nil {
+		return err
+	}
+	wkt, err := readSpatialReference(a.Attributes.GetStringOrFail(spatialReferenceFilePathKey), a.Attributes.GetStringOrFail(spatialReferenceDriverKey), a.Attributes.GetStringOrFail(spatialReferenceTableNameKey))
+	if err != nil {
+		return err
+	}
+	baseline, err := openFrequencyFile(baselinePath)
+	if err != nil {
+		return err
+	}
+	defer baseline.Close()
+	alternative, err := openFrequencyFile(alternativePath)
+	if err != nil {
+		return err
+	}
+	defer alternative.Close()
+	csvFile, err := os.Create(csvFilePath)
+	if err != nil {
+		return err
+	}
+	defer csvFile.Close()
+	w := bufio.NewWriter(csvFile)
+	writeComparisonCsvHeader(w, returnPeriods)
+	rw, err := resultswriters.InitSpatialResultsWriter_WKT_Projected(spatialFilePath, comparisonSpatialOutputTable, spatialDriver, wkt)
+	if err != nil {
+		return err
+	}
+	defer rw.Close()
+	headers := comparisonHeaders(returnPeriods)
+	summary, err := compareScenarios(baseline, alternative, returnPeriods, plottingPosition, func(c ScenarioComparison) error {
+		worse := int32(0)
+		if c.Worse {
+			worse = 1
+		}
+		result := []interface{}{c.Fdid, c.X, c.Y, c.BaselineTAAL, c.AlternativeTAAL, c.AALReduction, worse}
+		for j := range c.DamagesAvoided {
+			result = append(result, c.BaselineDamages[j], c.AlternativeDamages[j], c.DamagesAvoided[j])
+		}
+		rw.Write(consequences.Result{Headers: headers, Result: result})
+		return writeComparisonCsvRow(w, c)
+	})
+	if err != nil {
+		return err
+	}
+	err = w.Flush()
+	if err != nil {
+		return err
+	}
+	if summary.WorseCount > 0 {
+		log.Printf("%v of %v structures have a larger aal with the alternative\n", summary.WorseCount, summary.StructureCount)
+	}
+	summaryFile, err := os.Create(summaryFilePath)
+	if err != nil {
+		return err
+	}
+	defer summaryFile.Close()
+	return writeScenarioSummary(summaryFile, returnPeriods, summary)
+}
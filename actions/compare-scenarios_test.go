@@ -0,0 +1,73 @@
+package actions
+
+import (
+	"bufio"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_CompareScenarios(t *testing.T) {
+	dir := t.TempDir()
+	baselinePath, alternativePath := filepath.Join(dir, "baseline.csv"), filepath.Join(dir, "alternative.csv")
+	writeRealizationFrequencyFile(t, baselinePath, []realizationStructure{
+		{Fdid: "a", TAAL: 10, TotalDamage: []BlockEventValue{{BlockNumber: 1, Value: 30}, {BlockNumber: 2, Value: 10}}},
+		{Fdid: "b", TAAL: 5, TotalDamage: []BlockEventValue{{BlockNumber: 2, Value: 20}}},
+	})
+	//a is protected, b is worse and c is only wet with the project.
+	writeRealizationFrequencyFile(t, alternativePath, []realizationStructure{
+		{Fdid: "a", TAAL: 4, TotalDamage: []BlockEventValue{{BlockNumber: 1, Value: 16}}},
+		{Fdid: "b", TAAL: 6, TotalDamage: []BlockEventValue{{BlockNumber: 2, Value: 24}}},
+		{Fdid: "c", TAAL: 1, TotalDamage: []BlockEventValue{{BlockNumber: 3, Value: 4}}},
+	})
+	baseline, err := openFrequencyFile(baselinePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer baseline.Close()
+	alternative, err := openFrequencyFile(alternativePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer alternative.Close()
+	sb := strings.Builder{}
+	w := bufio.NewWriter(&sb)
+	writeComparisonCsvHeader(w, []float64{4})
+	summary, err := compareScenarios(baseline, alternative, []float64{4}, Weibull, func(c ScenarioComparison) error {
+		return writeComparisonCsvRow(w, c)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Flush()
+	expected := []string{
+		"fd_id,x,y,baseline_taal,alternative_taal,aal_reduction,worse,baseline_4yr,alternative_4yr,avoided_4yr",
+		"a,1,2,10.00,4.00,6.00,false,30.00,16.00,14.00",
+		"b,1,2,5.00,6.00,-1.00,true,20.00,24.00,-4.00",
+		"c,1,2,0.00,1.00,-1.00,true,0.00,4.00,-4.00",
+	}
+	lines := strings.Split(strings.TrimSpace(sb.String()), "\n")
+	if len(lines) != len(expected) {
+		t.Fatalf("expected %v lines, got %v", len(expected), sb.String())
+	}
+	for i, e := range expected {
+		if lines[i] != e {
+			t.Errorf("expected line %v to be %v, got %v", i, e, lines[i])
+		}
+	}
+	if summary.BaselineAAL != 15 || summary.AlternativeAAL != 11 || summary.StructureCount != 3 || summary.WorseCount != 2 {
+		t.Errorf("unexpected summary %v", summary)
+	}
+	//the watershed 4 year damage is the largest block total of each scenario.
+	if summary.BaselineDamages[0] != 30 || summary.AlternativeDamages[0] != 24 {
+		t.Errorf("expected 4 year watershed damages of 30 and 24, got %v and %v", summary.BaselineDamages[0], summary.AlternativeDamages[0])
+	}
+	sb.Reset()
+	err = writeScenarioSummary(&sb, []float64{4}, summary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(sb.String(), "metric,return_period,baseline,alternative,reduction\naal,,15.00,11.00,4.00\ndamage,4,30.00,24.00,6.00\n") {
+		t.Errorf("unexpected summary csv %v", sb.String())
+	}
+}
@@ -1,32 +1,38 @@
 package actions
 
 import (
-	"encoding/json"
 	"errors"
-	"fmt"
-	"log"
-	"math"
 	"strconv"
 	"strings"
 
-	"github.com/USACE/go-consequences/compute"
 	"github.com/USACE/go-consequences/consequences"
-	"github.com/USACE/go-consequences/geography"
 	gc "github.com/USACE/go-consequences/hazardproviders"
 	"github.com/USACE/go-consequences/hazards"
 	"github.com/USACE/go-consequences/resultswriters"
 	"github.com/USACE/go-consequences/structureprovider"
-	"github.com/USACE/go-consequences/structures"
 	"github.com/usace-cloud-compute/cc-go-sdk"
 	lhp "github.com/usace-cloud-compute/consequences-runner/hazardproviders"
 )
 
 const (
-	meandepthgridDatasourceName                 string = "mean-depth-grids"     //plugin datasource name required
-	stdevdepthgridDatasourceName                string = "stdev-depth-grids"    //plugin datasource name required
-	meanvelocitygridDatasourceName              string = "mean-velocity-grids"  //plugin datasource name required
-	stdevvelocitygridDatasourceName             string = "stdev-velocity-grids" //plugin datasource name required
-	verticalSliceName                           string = "vertical-slice"
+	meandepthgridDatasourceName                 string = "mean-depth-grids"                 //plugin datasource name required
+	stdevdepthgridDatasourceName                string = "stdev-depth-grids"                //plugin datasource name required
+	meanvelocitygridDatasourceName              string = "mean-velocity-grids"              //plugin datasource name required
+	stdevvelocitygridDatasourceName             string = "stdev-velocity-grids"             //plugin datasource name required
+	meandurationgridDatasourceName              string = "mean-duration-grids"              //optional, hours
+	stdevdurationgridDatasourceName             string = "stdev-duration-grids"             //optional, hours
+	meanwaveheightgridDatasourceName            string = "mean-wave-height-grids"           //optional
+	stdevwaveheightgridDatasourceName           string = "stdev-wave-height-grids"          //optional
+	depthVelocityCorrelationGridName            string = "depth-velocity-correlation-grids" //optional, one correlation coefficient grid per frequency
+	depthVelocityCorrelationKey                 string = "depthVelocityCorrelation"         //optional, the correlation coefficient between -1 and 1, or where the correlation grids have no value. with vertical slices each frequency has the square of the slice count samples.
+	uncertaintyDistributionKey                  string = "uncertaintyDistribution"          //optional, normal, lognormal, truncated-normal or triangular. defaults to normal.
+	verticalSliceName                           string = "vertical-slice"                   //required with the vertical-slice sampling method
+	samplingMethodKey                           string = "samplingMethod"                   //optional, vertical-slice, monte-carlo or latin-hypercube. defaults to vertical-slice.
+	samplesKey                                  string = "samples"                          //required with the monte-carlo and latin-hypercube sampling methods, samples per structure per frequency
+	samplingSeedKey                             string = "samplingSeed"                     //optional, defaults to 1234.
+	aalPercentilesKey                           string = "aalPercentiles"                   //optional, comma separated percentiles between 0 and 1 of the aal of each sample. defaults to 0.05, 0.5, 0.95.
+	defaultAALPercentiles                       string = "0.05, 0.5, 0.95"
+	convergenceToleranceKey                     string = "convergenceTolerance" //optional, the largest relative standard error of the mean damage considered converged. defaults to 0.05.
 	femaMultiParameterFrequencyBasedActionName  string = "compute-fema-frequency"
 	femaSingleParameterFrequencyBasedActionName string = "compute-fema-frequency-single-parameter"
 )
@@ -36,6 +42,18 @@ func init() {
 	cc.ActionRegistry.RegisterAction(femaSingleParameterFrequencyBasedActionName, &FemaSingleParameterFrequencyBasedAction{})
 }
 
+// sampledGridDatasources are the mean and stdev grid attributes of each hazard parameter the fema frequency actions can sample.
+var sampledGridDatasources = []struct {
+	parameter hazards.Parameter
+	mean      string
+	stdev     string
+}{
+	{hazards.Depth, meandepthgridDatasourceName, stdevdepthgridDatasourceName},
+	{hazards.Velocity, meanvelocitygridDatasourceName, stdevvelocitygridDatasourceName},
+	{hazards.Duration, meandurationgridDatasourceName, stdevdurationgridDatasourceName},
+	{hazards.WaveHeight, meanwaveheightgridDatasourceName, stdevwaveheightgridDatasourceName},
+}
+
 type FemaMultiParameterFrequencyBasedAction struct {
 	cc.ActionRunnerBase
 }
@@ -44,24 +62,67 @@ type FemaSingleParameterFrequencyBasedAction struct {
 }
 
 func (ar *FemaMultiParameterFrequencyBasedAction) Run() error {
-	a := ar.Action
-	// get all relevant parameters
-	tablename := a.Attributes.GetStringOrFail(tablenameKey)
-	//vsis3prefix := a.Parameters.GetStringOrFail(vsis3prefixKey)
-	meandepthGridPathString := a.Attributes.GetStringOrFail(meandepthgridDatasourceName)         // expected this is a vsis3 object
-	meanvelocityGridPathString := a.Attributes.GetStringOrFail(meanvelocitygridDatasourceName)   // expected this is a vsis3 object
-	stdevdepthGridPathString := a.Attributes.GetStringOrFail(stdevdepthgridDatasourceName)       // expected this is a vsis3 object
-	stdevvelocityGridPathString := a.Attributes.GetStringOrFail(stdevvelocitygridDatasourceName) // expected this is a vsis3 object
-	//durationGridPaths := a.Parameters.GetStringOrFail(DurationGridPathsKey)// expected this is a vsis3 object
-	frequencystring := a.Attributes.GetStringOrFail(FrequenciesKey)
-	verticalSlicestring := a.Attributes.GetStringOrFail(verticalSliceName)
-	inventoryPathKey := a.Attributes.GetStringOrFail(inventoryPathKey) //expected this is local - needs to agree with the payload input datasource name
-	inventoryDriver := a.Attributes.GetStringOrFail(inventoryDriverKey)
+	return runFemaFrequency(ar.Action.Attributes, []hazards.Parameter{hazards.Depth, hazards.Velocity})
+}
+func (ar *FemaSingleParameterFrequencyBasedAction) Run() error {
+	return runFemaFrequency(ar.Action.Attributes, []hazards.Parameter{hazards.Depth})
+}
+
+// readParameterGrids returns the grids of every parameter for each frequency, the required parameters must be provided and the rest are included when their mean grids are.
+func readParameterGrids(attributes cc.PayloadAttributes, required []hazards.Parameter, frequencyCount int) ([][]lhp.ParameterGrids, error) {
+	grids := make([][]lhp.ParameterGrids, frequencyCount)
+	for _, ds := range sampledGridDatasources {
+		isRequired := false
+		for _, p := range required {
+			if p == ds.parameter {
+				isRequired = true
+			}
+		}
+		meanPathString := attributes.GetStringOrDefault(ds.mean, "")
+		if meanPathString == "" {
+			if isRequired {
+				return grids, errors.New(ds.mean + " is required")
+			}
+			continue
+		}
+		// grid paths expected to be comma separated variables of string path parts
+		MeanGridPaths := strings.Split(meanPathString, ", ")
+		StdevGridPaths := strings.Split(attributes.GetStringOrFail(ds.stdev), ", ")
+		if len(MeanGridPaths) != len(StdevGridPaths) {
+			return grids, errors.New(ds.mean + " and " + ds.stdev + " have different numbers of paths")
+		}
+		if len(MeanGridPaths) != frequencyCount {
+			return grids, errors.New("hazard grids have different numbers of paths than the frequencies list")
+		}
+		for i := range MeanGridPaths {
+			grids[i] = append(grids[i], lhp.ParameterGrids{Parameter: ds.parameter, MeanPath: MeanGridPaths[i], StdevPath: StdevGridPaths[i]})
+		}
+	}
+	return grids, nil
+}
+
+// meanAndStdevProcess treats a sampled depth, or a sampled velocity when velocity is provided, at or below zero as no hazard.
+func meanAndStdevProcess(valueIn hazards.HazardData, hazard hazards.HazardEvent) (hazards.HazardEvent, error) {
+	if valueIn.Depth <= 0 {
+		return hazard, gc.NoHazardFoundError{}
+	}
+	if valueIn.Velocity != -901 && valueIn.Velocity <= 0 {
+		return hazard, gc.NoHazardFoundError{}
+	}
+	e := hazards.HazardDataToMultiParameter(valueIn)
+	return e, nil
+}
 
-	outputDriver := a.Attributes.GetStringOrFail(outputDriverKey)
-	outputFileName := a.Attributes.GetStringOrFail(outputFileNameKey) //expected this is local - needs to agree with the payload output datasource name
-	//useKnowledgeUncertainty, err := strconv.ParseBool(a.Parameters.GetStringOrFail(useKnowledgeUncertaintyKey))
-	damageFunctionPath := a.Attributes.GetStringOrFail(damageFunctionPathKey) //expected this is local - needs to agree with the payload input datasource name
+func runFemaFrequency(attributes cc.PayloadAttributes, required []hazards.Parameter) error {
+	// get all relevant parameters
+	tablename := attributes.GetStringOrFail(tablenameKey)
+	frequencystring := attributes.GetStringOrFail(FrequenciesKey)
+	inventoryPathKey := attributes.GetStringOrFail(inventoryPathKey) //expected this is local - needs to agree with the payload input datasource name
+	inventoryDriver := attributes.GetStringOrFail(inventoryDriverKey)
+
+	outputDriver := attributes.GetStringOrFail(outputDriverKey)
+	outputFileName := attributes.GetStringOrFail(outputFileNameKey)         //expected this is local - needs to agree with the payload output datasource name
+	damageFunctionPath := attributes.GetStringOrFail(damageFunctionPathKey) //expected this is local - needs to agree with the payload input datasource name
 	// frequencies expected to be comma separated variables of floats.
 	stringFrequencies := strings.Split(frequencystring, ", ")
 	frequencies := make([]float64, 0)
@@ -72,441 +133,115 @@ func (ar *FemaMultiParameterFrequencyBasedAction) Run() error {
 		}
 		frequencies = append(frequencies, f)
 	}
-	// vertical slices expected to be comma separated variables of floats.
-	stringverticalslice := strings.Split(verticalSlicestring, ", ")
-	verticalslices := make([]float64, 0)
-	for _, s := range stringverticalslice {
-		f, err := strconv.ParseFloat(s, 64)
-		if err != nil {
-			return err
-		}
-		verticalslices = append(verticalslices, f)
+	// grids are read in the order of the frequencies attribute and reordered with their frequencies from most to least frequent.
+	frequencies, order, err := sortFrequencies(frequencies)
+	if err != nil {
+		return err
 	}
-	// grid paths expected to be comma separated variables of string path parts
-	MeanDepthGridPaths := strings.Split(meandepthGridPathString, ", ")
-	MeanVelocityGridPaths := strings.Split(meanvelocityGridPathString, ", ")
-	StdevDepthGridPaths := strings.Split(stdevdepthGridPathString, ", ")
-	StdevVelocityGridPaths := strings.Split(stdevvelocityGridPathString, ", ")
-	if len(MeanDepthGridPaths) != len(MeanVelocityGridPaths) {
-		return errors.New("depth grids and velocity grids have different numbers of paths")
+	ead, err := initEADOptions(attributes, SpecialEAD)
+	if err != nil {
+		return err
 	}
-	if len(MeanDepthGridPaths) != len(frequencies) {
-		return errors.New("hazard grids have different numbers of paths than the frequencies list")
+	samplingMethod, err := lhp.ParseSamplingMethod(attributes.GetStringOrDefault(samplingMethodKey, string(lhp.VerticalSlices)))
+	if err != nil {
+		return err
 	}
-	hps := make([]lhp.Mean_and_stdev_HazardProvider, 0)
-	process := func(valueIn hazards.HazardData, hazard hazards.HazardEvent) (hazards.HazardEvent, error) {
-		if valueIn.Depth <= 0 {
-			return hazard, gc.NoHazardFoundError{}
-		}
-		if valueIn.Velocity <= 0 {
-			return hazard, gc.NoHazardFoundError{}
-		}
-		h := hazards.HazardData{
-			Depth:    valueIn.Depth,
-			Velocity: valueIn.Velocity,
+	verticalslices := make([]float64, 0)
+	sampling := lhp.Sampling{Method: samplingMethod}
+	convergenceTolerance := 0.0
+	if samplingMethod == lhp.VerticalSlices {
+		// vertical slices expected to be comma separated variables of floats.
+		stringverticalslice := strings.Split(attributes.GetStringOrFail(verticalSliceName), ", ")
+		for _, s := range stringverticalslice {
+			f, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return err
+			}
+			verticalslices = append(verticalslices, f)
 		}
-		e := hazards.HazardDataToMultiParameter(h)
-		return e, nil
-	}
-	for i, dp := range MeanDepthGridPaths {
-		hp, err := lhp.Init(dp, StdevDepthGridPaths[i], MeanVelocityGridPaths[i], StdevVelocityGridPaths[i], verticalslices)
+	} else {
+		sampling.Samples = attributes.GetIntOrFail(samplesKey)
+		sampling.Seed = attributes.GetInt64OrDefault(samplingSeedKey, 1234)
+		convergenceTolerance = attributes.GetFloatOrDefault(convergenceToleranceKey, 0.05)
+		err = sampling.Validate()
 		if err != nil {
 			return err
 		}
-		hp.SetProcess(process)
-		hps = append(hps, hp)
 	}
-	// inventory path expected to be a local path
-	// damage function path expected to be a local path
-	sp, err := structureprovider.InitStructureProviderwithOcctypePath(inventoryPathKey, tablename, inventoryDriver, damageFunctionPath)
-	sp.SetDeterministic(true)
+	fo, err := initFrequencyOutput(attributes, frequencies)
 	if err != nil {
 		return err
 	}
-	fmt.Sprintln(sp.FilePath)
-	//results writer
-	outfp := outputFileName //fmt.Sprintf("%s/%s", localData, outputFileName)
-	var rw consequences.ResultsWriter
-	sr := sp.SpatialReference()
-	rw, err = resultswriters.InitSpatialResultsWriter_WKT_Projected(outfp, outputLayerName, outputDriver, sr)
+	percentiles, err := parsePercentiles(attributes.GetStringOrDefault(aalPercentilesKey, defaultAALPercentiles))
 	if err != nil {
 		return err
 	}
-	defer rw.Close()
-
-	ComputeMultiFrequencyMeanStdev(hps, frequencies, sp, rw)
-	return nil
-}
-func ComputeMultiFrequencyMeanStdev(hps []lhp.Mean_and_stdev_HazardProvider, freqs []float64, sp consequences.StreamProvider, w consequences.ResultsWriter) {
-	fmt.Printf("Computing %v frequencies\n", len(freqs))
-	//ASSUMPTION hazard providers and frequencies are in the same order
-	//ASSUMPTION ordered by most frequent to least frequent event
-	//ASSUMPTION! get bounding box from largest frequency.
-
-	largestHp := hps[len(hps)-1]
-	bbox, err := largestHp.HazardBoundary()
+	distribution, err := lhp.ParseDistribution(attributes.GetStringOrDefault(uncertaintyDistributionKey, string(lhp.Normal)))
 	if err != nil {
-		fmt.Print(err)
-		return
+		return err
 	}
-	//set up output tables for all frequencies.
-	header := []string{"ORIG_ID", "REPVAL", "STORY", "FOUND_T", "FOUND_H", "x", "y", "OccType", "DamCat", "BASEFIN", "FFH", "DEMFT", "BAAL", "CAAL", "TAAL", "PROB"}
-
-	for _, f := range freqs {
-		header = append(header, fmt.Sprintf("%1.6fMS", f))
-		header = append(header, fmt.Sprintf("%1.6fSS", f))
-		header = append(header, fmt.Sprintf("%1.6fMC", f))
-		header = append(header, fmt.Sprintf("%1.6fSC", f))
-		header = append(header, fmt.Sprintf("%1.6fMH", f))
-		header = append(header, fmt.Sprintf("%1.6fSH", f))
+	grids, err := readParameterGrids(attributes, required, len(frequencies))
+	if err != nil {
+		return err
 	}
-
-	sp.ByBbox(bbox, func(f consequences.Receptor) {
-		s, sok := f.(structures.StructureDeterministic)
-		if !sok {
-			return
-		}
-		results := []interface{}{s.Name, s.StructVal, s.NumStories, s.FoundType, s.FoundHt, s.Location().X, s.Location().Y, s.OccType.Name, s.DamCat, "unkown", s.FoundHt + s.GroundElevation, s.GroundElevation, 0.0, 0.0, 0.0, 0.0}
-
-		msEADs := make([]float64, len(freqs))
-		mcEADs := make([]float64, len(freqs))
-		ssEADs := make([]float64, len(freqs))
-		scEADs := make([]float64, len(freqs))
-		//ProvideHazard works off of a geography.Location
-		gotWet := false
-		firstProb := 0.0
-		for index, hp := range hps {
-			d, err := hp.Hazards(geography.Location{X: f.Location().X, Y: f.Location().Y})
-			//compute damages based on hazard being able to provide depth
-			if err != nil {
-				results = append(results, 0.0)
-				results = append(results, 0.0)
-				results = append(results, 0.0)
-				results = append(results, 0.0)
-				results = append(results, "no-hazard")
-				results = append(results, "no-hazard")
-				continue
-			}
-			meanSliceDamage := 0.0
-			meanSliceContent := 0.0
-			meanSliceDepth := 0.0
-			meanSliceVelocity := 0.0
-			stdevSliceDamage := 0.0
-			stdevSliceContent := 0.0
-			stdevSliceDepth := 0.0
-			stdevSliceVelocity := 0.0
-			sampleSize := 0
-			for _, hazard := range d {
-				sampleSize++
-				r, err3 := f.Compute(hazard)
-				sliceDepth := hazard.Depth()
-				sliceVelocity := hazard.Velocity()
-				sliceContent := 0.0
-				sliceStructure := 0.0
-				if err3 == nil {
-					if !gotWet {
-						firstProb = freqs[index] //how does this make sense?
-					}
-					gotWet = true
-					sliceStructureI, err := r.Fetch("structure damage")
-					if err != nil {
-						log.Fatal("could not fetch structure damage")
-					}
-					sliceStructure = sliceStructureI.(float64)
-					sliceContentI, err := r.Fetch("content damage")
-					if err != nil {
-						log.Fatal("could not fetch content damage")
-					}
-					sliceContent = sliceContentI.(float64)
-				} else {
-					sliceStructure = 0.0
-					sliceContent = 0.0
-					sliceDepth = 0.0
-					sliceVelocity = 0.0
-				}
-				meanSliceDamage, stdevSliceDamage = meanAndStdev(meanSliceDamage, stdevSliceDamage, sampleSize, sliceStructure)
-				meanSliceContent, stdevSliceContent = meanAndStdev(meanSliceContent, stdevSliceContent, sampleSize, sliceContent)
-				meanSliceDepth, stdevSliceDepth = meanAndStdev(meanSliceDepth, stdevSliceDepth, sampleSize, sliceDepth)
-				meanSliceVelocity, stdevSliceVelocity = meanAndStdev(meanSliceVelocity, stdevSliceVelocity, sampleSize, sliceVelocity)
-
-			}
-
-			msEADs[index] = meanSliceDamage
-			mcEADs[index] = meanSliceContent
-			ssEADs[index] = math.Sqrt(stdevSliceDamage)
-			scEADs[index] = math.Sqrt(stdevSliceContent)
-			meanHazarddata := hazards.HazardData{
-				Depth:    meanSliceDepth,
-				Velocity: math.Sqrt(meanSliceVelocity),
-			}
-			stdevHazarddata := hazards.HazardData{
-				Depth:    stdevSliceDepth,
-				Velocity: math.Sqrt(stdevSliceVelocity),
-			}
-			meanHazard := hazards.HazardDataToMultiParameter(meanHazarddata)
-			stdevHazard := hazards.HazardDataToMultiParameter(stdevHazarddata)
-			results = append(results, msEADs[index])
-			results = append(results, ssEADs[index])
-			results = append(results, mcEADs[index])
-			results = append(results, scEADs[index])
-			b, err := json.Marshal(meanHazard)
-			if err != nil {
-				log.Fatal(err)
-			}
-			stdevb, err := json.Marshal(stdevHazard)
-			if err != nil {
-				log.Fatal(err)
-			}
-			shaz := string(b)
-			stdevsshaz := string(stdevb)
-			results = append(results, shaz)
-			results = append(results, stdevsshaz)
-		}
-		results[15] = firstProb
-		sEAD := compute.ComputeSpecialEAD(msEADs, freqs) //use compute special ead to not create triangle below the most frequent event
-		results[12] = sEAD
-		cEAD := compute.ComputeSpecialEAD(mcEADs, freqs) //use compute special ead to not create triangle below the most frequent event
-		results[13] = cEAD
-		results[14] = sEAD + cEAD
-		var ret = consequences.Result{Headers: header, Result: results}
-		if gotWet {
-			w.Write(ret)
+	// without a correlation depth and velocity share each vertical slice quantile.
+	correlation, correlationErr := attributes.GetFloat(depthVelocityCorrelationKey)
+	correlationGridPathString := attributes.GetStringOrDefault(depthVelocityCorrelationGridName, "")
+	correlationGridPaths := make([]string, 0)
+	if correlationGridPathString != "" {
+		correlationGridPaths = strings.Split(correlationGridPathString, ", ")
+		if len(correlationGridPaths) != len(frequencies) {
+			return errors.New("correlation grids have different numbers of paths than the frequencies list")
 		}
-
-	})
-
-}
-func meanAndStdev(mean float64, stdev float64, sampleSize int, value float64) (float64, float64) {
-	if sampleSize == 1 {
-		stdev = 0
-		mean = value
-	} else {
-		stdev = (((float64(sampleSize-2) / float64(sampleSize-1)) * stdev) + (math.Pow((value-mean), 2))/float64(sampleSize))
-		mean = mean + ((value - mean) / float64(sampleSize))
-	}
-
-	return mean, stdev
-}
-
-func (ar *FemaSingleParameterFrequencyBasedAction) Run() error {
-	a := ar.Action
-	// get all relevant parameters
-	tablename := a.Attributes.GetStringOrFail(tablenameKey)
-	//vsis3prefix := a.Parameters.GetStringOrFail(vsis3prefixKey)
-	meandepthGridPathString := a.Attributes.GetStringOrFail(meandepthgridDatasourceName) // expected this is a vsis3 object
-	//meanvelocityGridPathString := a.Parameters.GetStringOrFail(meanvelocitygridDatasourceName)   // expected this is a vsis3 object
-	stdevdepthGridPathString := a.Attributes.GetStringOrFail(stdevdepthgridDatasourceName) // expected this is a vsis3 object
-	//stdevvelocityGridPathString := a.Parameters.GetStringOrFail(stdevvelocitygridDatasourceName) // expected this is a vsis3 object
-	//durationGridPaths := a.Parameters.GetStringOrFail(DurationGridPathsKey)// expected this is a vsis3 object
-	frequencystring := a.Attributes.GetStringOrFail(FrequenciesKey)
-	verticalSlicestring := a.Attributes.GetStringOrFail(verticalSliceName)
-	inventoryPathKey := a.Attributes.GetStringOrFail(inventoryPathKey) //expected this is local - needs to agree with the payload input datasource name
-	inventoryDriver := a.Attributes.GetStringOrFail(inventoryDriverKey)
-
-	outputDriver := a.Attributes.GetStringOrFail(outputDriverKey)
-	outputFileName := a.Attributes.GetStringOrFail(outputFileNameKey) //expected this is local - needs to agree with the payload output datasource name
-	//useKnowledgeUncertainty, err := strconv.ParseBool(a.Parameters.GetStringOrFail(useKnowledgeUncertaintyKey))
-	damageFunctionPath := a.Attributes.GetStringOrFail(damageFunctionPathKey) //expected this is local - needs to agree with the payload input datasource name
-	// frequencies expected to be comma separated variables of floats.
-	stringFrequencies := strings.Split(frequencystring, ", ")
-	frequencies := make([]float64, 0)
-	for _, s := range stringFrequencies {
-		f, err := strconv.ParseFloat(s, 64)
-		if err != nil {
-			return err
+		if correlationErr != nil {
+			correlation = 0
 		}
-		frequencies = append(frequencies, f)
 	}
-	// vertical slices expected to be comma separated variables of floats.
-	stringverticalslice := strings.Split(verticalSlicestring, ", ")
-	verticalslices := make([]float64, 0)
-	for _, s := range stringverticalslice {
-		f, err := strconv.ParseFloat(s, 64)
+	hps := make([]FrequencyHazardProvider, 0)
+	for _, i := range order {
+		hp, err := lhp.Init(grids[i], verticalslices)
 		if err != nil {
 			return err
 		}
-		verticalslices = append(verticalslices, f)
-	}
-	// grid paths expected to be comma separated variables of string path parts
-	MeanDepthGridPaths := strings.Split(meandepthGridPathString, ", ")
-	//MeanVelocityGridPaths := strings.Split(meanvelocityGridPathString, ", ")
-	StdevDepthGridPaths := strings.Split(stdevdepthGridPathString, ", ")
-	//StdevVelocityGridPaths := strings.Split(stdevvelocityGridPathString, ", ")
-	if len(MeanDepthGridPaths) != len(StdevDepthGridPaths) {
-		return errors.New("mean depth grids and stdev depth grids have different numbers of paths")
-	}
-	if len(MeanDepthGridPaths) != len(frequencies) {
-		return errors.New("hazard grids have different numbers of paths than the frequencies list")
-	}
-	hps := make([]lhp.SingleParameter_Mean_and_stdev_HazardProvider, 0)
-	process := func(valueIn hazards.HazardData, hazard hazards.HazardEvent) (hazards.HazardEvent, error) {
-		if valueIn.Depth <= 0 {
-			return hazard, gc.NoHazardFoundError{}
+		defer hp.Close()
+		hp.SetProcess(meanAndStdevProcess)
+		hp.SetDistribution(distribution)
+		if samplingMethod != lhp.VerticalSlices {
+			hp.SetSampling(sampling)
 		}
-		h := hazards.HazardData{
-			Depth: valueIn.Depth,
+		if len(correlationGridPaths) > 0 {
+			err = hp.SetDepthVelocityCorrelationGrid(correlationGridPaths[i], correlation)
+		} else if correlationErr == nil {
+			err = hp.SetDepthVelocityCorrelation(correlation)
 		}
-		e := hazards.HazardDataToMultiParameter(h)
-		return e, nil
-	}
-	for i, dp := range MeanDepthGridPaths {
-		hp, err := lhp.InitSingleParameter(dp, StdevDepthGridPaths[i], verticalslices)
 		if err != nil {
 			return err
 		}
-		hp.SetProcess(process)
 		hps = append(hps, hp)
 	}
 	// inventory path expected to be a local path
 	// damage function path expected to be a local path
 	sp, err := structureprovider.InitStructureProviderwithOcctypePath(inventoryPathKey, tablename, inventoryDriver, damageFunctionPath)
-	sp.SetDeterministic(true)
 	if err != nil {
 		return err
 	}
-	fmt.Sprintln(sp.FilePath)
+	sp.SetDeterministic(true)
 	//results writer
-	outfp := outputFileName //fmt.Sprintf("%s/%s", localData, outputFileName)
 	var rw consequences.ResultsWriter
 	sr := sp.SpatialReference()
-	rw, err = resultswriters.InitSpatialResultsWriter_WKT_Projected(outfp, outputLayerName, outputDriver, sr)
+	rw, err = resultswriters.InitSpatialResultsWriter_WKT_Projected(outputFileName, outputLayerName, outputDriver, sr)
 	if err != nil {
 		return err
 	}
 	defer rw.Close()
 
-	ComputeMultiFrequencyMeanStdev_SingleParameter(hps, frequencies, sp, rw)
-	return nil
-}
-func ComputeMultiFrequencyMeanStdev_SingleParameter(hps []lhp.SingleParameter_Mean_and_stdev_HazardProvider, freqs []float64, sp consequences.StreamProvider, w consequences.ResultsWriter) {
-	fmt.Printf("Computing %v frequencies\n", len(freqs))
-	//ASSUMPTION hazard providers and frequencies are in the same order
-	//ASSUMPTION ordered by most frequent to least frequent event
-	//ASSUMPTION! get bounding box from largest frequency.
-
-	largestHp := hps[len(hps)-1]
-	bbox, err := largestHp.HazardBoundary()
-	if err != nil {
-		fmt.Print(err)
-		return
-	}
-	//set up output tables for all frequencies.
-	header := []string{"ORIG_ID", "REPVAL", "STORY", "FOUND_T", "FOUND_H", "x", "y", "OccType", "DamCat", "BASEFIN", "FFH", "DEMFT", "BAAL", "CAAL", "TAAL", "PROB"}
-
-	for _, f := range freqs {
-		header = append(header, fmt.Sprintf("%1.6fMS", f))
-		header = append(header, fmt.Sprintf("%1.6fSS", f))
-		header = append(header, fmt.Sprintf("%1.6fMC", f))
-		header = append(header, fmt.Sprintf("%1.6fSC", f))
-		header = append(header, fmt.Sprintf("%1.6fMH", f))
-		header = append(header, fmt.Sprintf("%1.6fSH", f))
+	fc := FrequencyCompute{
+		Frequencies:          frequencies,
+		EAD:                  ead,
+		Output:               fo,
+		Uncertain:            true,
+		Percentiles:          percentiles,
+		ConvergenceTolerance: convergenceTolerance,
 	}
-
-	sp.ByBbox(bbox, func(f consequences.Receptor) {
-		s, sok := f.(structures.StructureDeterministic)
-		if !sok {
-			return
-		}
-		results := []interface{}{s.Name, s.StructVal, s.NumStories, s.FoundType, s.FoundHt, s.Location().X, s.Location().Y, s.OccType.Name, s.DamCat, "unkown", s.FoundHt + s.GroundElevation, s.GroundElevation, 0.0, 0.0, 0.0, 0.0}
-
-		msEADs := make([]float64, len(freqs))
-		mcEADs := make([]float64, len(freqs))
-		ssEADs := make([]float64, len(freqs))
-		scEADs := make([]float64, len(freqs))
-		//ProvideHazard works off of a geography.Location
-		gotWet := false
-		firstProb := 0.0
-		for index, hp := range hps {
-			d, err := hp.Hazards(geography.Location{X: f.Location().X, Y: f.Location().Y})
-			//compute damages based on hazard being able to provide depth
-			if err != nil {
-				results = append(results, 0.0)
-				results = append(results, 0.0)
-				results = append(results, 0.0)
-				results = append(results, 0.0)
-				results = append(results, "no-hazard")
-				results = append(results, "no-hazard")
-				continue
-			}
-			meanSliceDamage := 0.0
-			meanSliceContent := 0.0
-			meanSliceDepth := 0.0
-			stdevSliceDamage := 0.0
-			stdevSliceContent := 0.0
-			stdevSliceDepth := 0.0
-			sampleSize := 0
-			for _, hazard := range d {
-				sampleSize++
-				r, err3 := f.Compute(hazard)
-				sliceDepth := hazard.Depth()
-				sliceContent := 0.0
-				sliceStructure := 0.0
-				if err3 == nil {
-					if !gotWet {
-						firstProb = freqs[index] //how does this make sense?
-					}
-					gotWet = true
-					sliceStructureI, err := r.Fetch("structure damage")
-					if err != nil {
-						log.Fatal("could not fetch structure damage")
-					}
-					sliceStructure = sliceStructureI.(float64)
-					sliceContentI, err := r.Fetch("content damage")
-					if err != nil {
-						log.Fatal("could not fetch content damage")
-					}
-					sliceContent = sliceContentI.(float64)
-				} else {
-					sliceStructure = 0.0
-					sliceContent = 0.0
-					sliceDepth = 0.0
-				}
-				meanSliceDamage, stdevSliceDamage = meanAndStdev(meanSliceDamage, stdevSliceDamage, sampleSize, sliceStructure)
-				meanSliceContent, stdevSliceContent = meanAndStdev(meanSliceContent, stdevSliceContent, sampleSize, sliceContent)
-				meanSliceDepth, stdevSliceDepth = meanAndStdev(meanSliceDepth, stdevSliceDepth, sampleSize, sliceDepth)
-
-			}
-
-			msEADs[index] = meanSliceDamage
-			mcEADs[index] = meanSliceContent
-			ssEADs[index] = math.Sqrt(stdevSliceDamage)
-			scEADs[index] = math.Sqrt(stdevSliceContent)
-			meanHazarddata := hazards.HazardData{
-				Depth: meanSliceDepth,
-			}
-			stdevHazarddata := hazards.HazardData{
-				Depth: stdevSliceDepth,
-			}
-			meanHazard := hazards.HazardDataToMultiParameter(meanHazarddata)
-			stdevHazard := hazards.HazardDataToMultiParameter(stdevHazarddata)
-			results = append(results, msEADs[index])
-			results = append(results, ssEADs[index])
-			results = append(results, mcEADs[index])
-			results = append(results, scEADs[index])
-			b, err := json.Marshal(meanHazard)
-			if err != nil {
-				log.Fatal(err)
-			}
-			stdevb, err := json.Marshal(stdevHazard)
-			if err != nil {
-				log.Fatal(err)
-			}
-			shaz := string(b)
-			stdevsshaz := string(stdevb)
-			results = append(results, shaz)
-			results = append(results, stdevsshaz)
-		}
-		results[15] = firstProb
-		sEAD := compute.ComputeSpecialEAD(msEADs, freqs) //use compute special ead to not create triangle below the most frequent event
-		results[12] = sEAD
-		cEAD := compute.ComputeSpecialEAD(mcEADs, freqs) //use compute special ead to not create triangle below the most frequent event
-		results[13] = cEAD
-		results[14] = sEAD + cEAD
-		var ret = consequences.Result{Headers: header, Result: results}
-		if gotWet {
-			w.Write(ret)
-		}
-
-	})
-
+	return fc.Compute(hps, sp, rw)
 }
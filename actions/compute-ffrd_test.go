@@ -0,0 +1,90 @@
+package actions
+
+import (
+	"math"
+	"testing"
+
+	"github.com/USACE/go-consequences/compute"
+	"github.com/USACE/go-consequences/hazards"
+	"github.com/usace-cloud-compute/cc-go-sdk"
+	lhp "github.com/usace-cloud-compute/consequences-runner/hazardproviders"
+)
+
+func Test_ParameterGridsIncludeOptionalParameters(t *testing.T) {
+	attributes := cc.PayloadAttributes{
+		meandepthgridDatasourceName:       "md1, md2",
+		stdevdepthgridDatasourceName:      "sd1, sd2",
+		meanwaveheightgridDatasourceName:  "mw1, mw2",
+		stdevwaveheightgridDatasourceName: "sw1, sw2",
+	}
+	grids, err := readParameterGrids(attributes, []hazards.Parameter{hazards.Depth}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := lhp.ParameterGrids{Parameter: hazards.WaveHeight, MeanPath: "mw2", StdevPath: "sw2"}
+	if len(grids[1]) != 2 || grids[1][0].Parameter != hazards.Depth || grids[1][1] != expected {
+		t.Errorf("expected depth and wave height grids for the second frequency, got %v", grids[1])
+	}
+	_, err = readParameterGrids(attributes, []hazards.Parameter{hazards.Depth, hazards.Velocity}, 2)
+	if err == nil {
+		t.Error("expected an error when a required parameter has no grids")
+	}
+	_, err = readParameterGrids(attributes, []hazards.Parameter{hazards.Depth}, 3)
+	if err == nil {
+		t.Error("expected an error when the grids do not match the frequencies")
+	}
+}
+
+func Test_MeanAndStdevProcess(t *testing.T) {
+	parameters := []hazards.Parameter{hazards.Depth, hazards.Duration}
+	e, err := meanAndStdevProcess(lhp.InitHazardData(parameters, []float64{2, 80}), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !e.Has(hazards.Duration) || e.Has(hazards.Velocity) || e.Duration() != 80 {
+		t.Errorf("expected only the sampled parameters on the event, got %v", e.Parameters())
+	}
+	_, err = meanAndStdevProcess(lhp.InitHazardData([]hazards.Parameter{hazards.Depth, hazards.Velocity}, []float64{2, 0}), nil)
+	if err == nil {
+		t.Error("expected no hazard when a sampled velocity is zero")
+	}
+	_, err = meanAndStdevProcess(lhp.InitHazardData(parameters, []float64{-0.5, 80}), nil)
+	if err == nil {
+		t.Error("expected no hazard when the sampled depth is below zero")
+	}
+}
+
+func Test_AALPercentilesIntegrateEachSample(t *testing.T) {
+	freqs := []float64{0.1, 0.01}
+	structure := [][]float64{{10, 20}, {30, 50}}
+	content := [][]float64{{1, 2}, {3, 5}}
+	special := EADOptions{Method: SpecialEAD, Tail: ConstantTail}
+	dist, err := aalPercentiles(structure, content, freqs, special, []float64{0, 0.5, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	low := compute.ComputeSpecialEAD([]float64{10, 30}, freqs)
+	high := compute.ComputeSpecialEAD([]float64{20, 50}, freqs)
+	if math.Abs(dist.Structure[0]-low) > 1e-9 || math.Abs(dist.Structure[2]-high) > 1e-9 {
+		t.Errorf("expected structure aal from %v to %v, got %v", low, high, dist.Structure)
+	}
+	//integration is linear so the median of two samples is the aal of the mean damages.
+	mean := compute.ComputeSpecialEAD([]float64{15, 40}, freqs) + compute.ComputeSpecialEAD([]float64{1.5, 4}, freqs)
+	if math.Abs(dist.Total[1]-mean) > 1e-9 {
+		t.Errorf("expected a median total aal of %v, got %v", mean, dist.Total[1])
+	}
+	dry, err := aalPercentiles([][]float64{nil, {30, 50}}, [][]float64{nil, {3, 5}}, freqs, special, []float64{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(dry.Structure[0]-compute.ComputeSpecialEAD([]float64{0, 50}, freqs)) > 1e-9 {
+		t.Errorf("expected a frequency without a hazard to contribute no damage, got %v", dry.Structure)
+	}
+	if percentileLabel(0.05) != "P5" || percentileLabel(0.025) != "P2_5" {
+		t.Errorf("unexpected percentile labels %v and %v", percentileLabel(0.05), percentileLabel(0.025))
+	}
+	_, err = parsePercentiles("0.5, 95")
+	if err == nil {
+		t.Error("expected an error for a percentile above one")
+	}
+}
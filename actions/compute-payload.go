@@ -8,6 +8,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/USACE/go-consequences/consequences"
 	"github.com/USACE/go-consequences/geography"
@@ -15,7 +16,6 @@ import (
 	"github.com/USACE/go-consequences/hazards"
 	"github.com/USACE/go-consequences/resultswriters"
 	"github.com/USACE/go-consequences/structureprovider"
-	"github.com/USACE/go-consequences/structures"
 	"github.com/usace-cloud-compute/cc-go-sdk"
 	lrw "github.com/usace-cloud-compute/consequences-runner/resultswriters"
 )
@@ -37,11 +37,15 @@ const (
 	outputDatasourceName          string = "Damages"       //plugin output datasource name required
 	localData                     string = "/app/data"
 	pluginName                    string = "consequences"
-	DepthGridPathsKey             string = "depth-grids"      // expected to contain the fully qualified vsis3 path set comma separated or the local path if the resource is included as an inputdatasource
-	VelocityGridPathsKey          string = "velocity-grids"   // expected to contain the fully qualified vsis3 path set comma separated or the local path if the resource is included as an inputdatasource
-	FrequenciesKey                string = "frequencies"      //expected to be comma separated string
-	inventoryPathKey              string = "Inventory"        //expected this is local - needs to agree with the payload input datasource name
-	damageFunctionPathKey         string = "damage-functions" //expected this is local - needs to agree with the payload input datasource name
+	DepthGridPathsKey             string = "depth-grids"        // expected to contain the fully qualified vsis3 path set comma separated or the local path if the resource is included as an inputdatasource
+	VelocityGridPathsKey          string = "velocity-grids"     // expected to contain the fully qualified vsis3 path set comma separated or the local path if the resource is included as an inputdatasource
+	DurationGridPathsKey          string = "duration-grids"     // optional, hours, same format as the depth grids
+	ArrivalTimeGridPathsKey       string = "arrival-time-grids" // optional, hours after the arrival start time, same format as the depth grids
+	WaveHeightGridPathsKey        string = "wave-height-grids"  // optional, same format as the depth grids
+	arrivalStartTimeKey           string = "arrivalStartTime"   // optional, RFC3339 time the arrival time grids are relative to.
+	FrequenciesKey                string = "frequencies"        //expected to be comma separated string
+	inventoryPathKey              string = "Inventory"          //expected this is local - needs to agree with the payload input datasource name
+	damageFunctionPathKey         string = "damage-functions"   //expected this is local - needs to agree with the payload input datasource name
 	projectIdKey                  string = "project-id"
 	runIdKey                      string = "run-id"
 	pgUserKey                     string = "PG_USER"
@@ -55,6 +59,19 @@ const (
 	computeCoastalEventActionName string = "compute-coastal-event"
 )
 
+// frequencyGridDatasources are the grid attributes of each hazard parameter compute-frequency can read, depth is first and is the primary grid.
+var frequencyGridDatasources = []struct {
+	parameter hazards.Parameter
+	key       string
+	required  bool
+}{
+	{hazards.Depth, DepthGridPathsKey, true},
+	{hazards.Velocity, VelocityGridPathsKey, true},
+	{hazards.Duration, DurationGridPathsKey, false},
+	{hazards.ArrivalTime, ArrivalTimeGridPathsKey, false},
+	{hazards.WaveHeight, WaveHeightGridPathsKey, false},
+}
+
 func init() {
 	cc.ActionRegistry.RegisterAction(computeEventActionName, &ComputeEventAction{})
 	cc.ActionRegistry.RegisterAction(computeFrequencyActionName, &ComputeFrequencyAction{})
@@ -130,6 +147,10 @@ func (ar *ComputeEventAction) Run() error {
 		return err
 	}
 	fmt.Sprintln(sp.FilePath)
+	par, err := initPopulationAtRisk(a.Attributes)
+	if err != nil {
+		return err
+	}
 
 	//initalize a results writer
 	var rw consequences.ResultsWriter
@@ -183,6 +204,7 @@ func (ar *ComputeEventAction) Run() error {
 			}
 			r.Result = append(r.Result, s)
 			if err3 == nil {
+				par.appendTo(&r, f, d)
 				rw.Write(r)
 			}
 		}
@@ -222,6 +244,10 @@ func (ar *ComputeCoastalEventAction) Run() error {
 		return err
 	}
 	fmt.Sprintln(sp.FilePath)
+	par, err := initPopulationAtRisk(a.Attributes)
+	if err != nil {
+		return err
+	}
 
 	//initalize a psql results writer
 	var rw consequences.ResultsWriter
@@ -272,6 +298,7 @@ func (ar *ComputeCoastalEventAction) Run() error {
 			r.Result = append(r.Result, runId)
 
 			if err3 == nil {
+				par.appendTo(&r, f, d)
 				rw.Write(r)
 			}
 		}
@@ -283,9 +310,6 @@ func (ar *ComputeFrequencyAction) Run() error {
 	// get all relevant parameters
 	tablename := a.Attributes.GetStringOrFail(tablenameKey)
 	//vsis3prefix := a.Parameters.GetStringOrFail(vsis3prefixKey)
-	depthGridPathString := a.Attributes.GetStringOrFail(DepthGridPathsKey)       // expected this is a vsis3 object
-	velocityGridPathString := a.Attributes.GetStringOrFail(VelocityGridPathsKey) // expected this is a vsis3 object
-	//durationGridPaths := a.Parameters.GetStringOrFail(DurationGridPathsKey)// expected this is a vsis3 object
 	frequencystring := a.Attributes.GetStringOrFail(FrequenciesKey)
 	inventoryPathKey := a.Attributes.GetStringOrFail(inventoryPathKey) //expected this is local - needs to agree with the payload input datasource name
 	inventoryDriver := a.Attributes.GetStringOrFail(inventoryDriverKey)
@@ -304,31 +328,33 @@ func (ar *ComputeFrequencyAction) Run() error {
 		}
 		frequencies = append(frequencies, f)
 	}
-	// grid paths expected to be comma separated variables of string path parts
-	DepthGridPaths := strings.Split(depthGridPathString, ", ")
-	VelocityGridPaths := strings.Split(velocityGridPathString, ", ")
-	if len(DepthGridPaths) != len(VelocityGridPaths) {
-		return errors.New("depth grids and velocity grids have different numbers of paths")
+	hpis, err := readFrequencyGrids(a.Attributes, len(frequencies))
+	if err != nil {
+		return err
 	}
-	if len(DepthGridPaths) != len(frequencies) {
-		return errors.New("hazard grids have different numbers of paths than the frequencies list")
+	// grids are ordered with their frequencies from most to least frequent.
+	frequencies, order, err := sortFrequencies(frequencies)
+	if err != nil {
+		return err
 	}
-	hps := make([]hazardproviders.HazardProvider, 0)
-	for i, dp := range DepthGridPaths {
-		hpi := hazardproviders.HazardProviderInfo{
-			Hazards: []hazardproviders.HazardProviderParameterAndPath{{
-				Hazard:   hazards.Depth,
-				FilePath: dp,
-			}, {
-				Hazard:   hazards.Velocity,
-				FilePath: VelocityGridPaths[i],
-			}},
+	ead, err := initEADOptions(a.Attributes, TrapezoidEAD)
+	if err != nil {
+		return err
+	}
+	hps := make([]FrequencyHazardProvider, 0)
+	for _, i := range order {
+		hp, err := hazardproviders.InitMulti(hpis[i])
+		if err != nil {
+			return err
 		}
-		hp, err := hazardproviders.InitMulti(hpi)
+		defer hp.Close()
+		// the multi hazard provider's boundary comes from whichever grid its map yields first, the depth grid is used instead.
+		depth, err := hazardproviders.Init(hpis[i].Hazards[0].FilePath)
 		if err != nil {
 			return err
 		}
-		hps = append(hps, hp)
+		defer depth.Close()
+		hps = append(hps, deterministicFrequencyProvider{HazardProvider: hp, boundary: depth})
 	}
 	// inventory path expected to be a local path
 	// damage function path expected to be a local path
@@ -348,130 +374,45 @@ func (ar *ComputeFrequencyAction) Run() error {
 	}
 	defer rw.Close()
 
-	ComputeMultiFrequency(hps, frequencies, sp, rw)
-	return nil
-}
-func ComputeMultiFrequency(hps []hazardproviders.HazardProvider, freqs []float64, sp consequences.StreamProvider, w consequences.ResultsWriter) {
-	fmt.Printf("Computing %v frequencies\n", len(freqs))
-	//ASSUMPTION hazard providers and frequencies are in the same order
-	//ASSUMPTION ordered by most frequent to least frequent event
-	//ASSUMPTION! get bounding box from largest frequency.
-
-	largestHp := hps[len(hps)-1]
-	bbox, err := largestHp.HazardBoundary()
+	fo, err := initFrequencyOutput(a.Attributes, frequencies)
 	if err != nil {
-		fmt.Print(err)
-		return
-	}
-	//set up output tables for all frequencies.
-	header := []string{"ORIG_ID", "REPVAL", "STORY", "FOUND_T", "FOUND_H", "x", "y", "OccType", "DamCat", "BASEFIN", "FFH", "DEMFT", "BAAL", "CAAL", "TAAL", "PROB"}
-
-	for _, f := range freqs {
-		header = append(header, fmt.Sprintf("%2.6fS", f))
-		header = append(header, fmt.Sprintf("%2.6fC", f))
-		header = append(header, fmt.Sprintf("%2.6fH", f))
+		return err
 	}
+	fc := FrequencyCompute{Frequencies: frequencies, EAD: ead, Output: fo}
+	return fc.Compute(hps, sp, rw)
+}
 
-	sp.ByBbox(bbox, func(f consequences.Receptor) {
-		s, sok := f.(structures.StructureDeterministic)
-		if !sok {
-			return
+// readFrequencyGrids returns the hazard grids of each frequency with the depth grid first, depth and velocity grids are required and the other parameters are included when their grids are provided.
+func readFrequencyGrids(attributes cc.PayloadAttributes, frequencyCount int) ([]hazardproviders.HazardProviderInfo, error) {
+	hpis := make([]hazardproviders.HazardProviderInfo, frequencyCount)
+	startTime := time.Time{}
+	startTimeString := attributes.GetStringOrDefault(arrivalStartTimeKey, "")
+	if startTimeString != "" {
+		t, err := time.Parse(time.RFC3339, startTimeString)
+		if err != nil {
+			return hpis, err
 		}
-		results := []interface{}{s.Name, s.StructVal, s.NumStories, s.FoundType, s.FoundHt, s.Location().X, s.Location().Y, s.OccType.Name, s.DamCat, "unkown", s.FoundHt + s.GroundElevation, s.GroundElevation, 0.0, 0.0, 0.0, 0.0}
-
-		sEADs := make([]float64, len(freqs))
-		cEADs := make([]float64, len(freqs))
-		hazarddata := make([]hazards.HazardEvent, len(freqs))
-		//ProvideHazard works off of a geography.Location
-		gotWet := false
-		firstProb := 0.0
-		for index, hp := range hps {
-			d, err := hp.Hazard(geography.Location{X: f.Location().X, Y: f.Location().Y})
-			hazarddata = append(hazarddata, d)
-			//compute damages based on hazard being able to provide depth
-
-			if err == nil {
-				r, err3 := f.Compute(d)
-				if err3 == nil {
-					if !gotWet {
-						firstProb = freqs[index]
-					}
-					gotWet = true
-					sdam, err := r.Fetch("structure damage")
-					if err != nil {
-						//panic?
-						sEADs[index] = 0.0
-					} else {
-						damage := sdam.(float64)
-						sEADs[index] = damage
-					}
-					cdam, err := r.Fetch("content damage")
-					if err != nil {
-						//panic?
-						cEADs[index] = 0.0
-					} else {
-						damage := cdam.(float64)
-						cEADs[index] = damage
-					}
-				}
-				results = append(results, sEADs[index])
-				results = append(results, cEADs[index])
-				b, err := json.Marshal(d)
-				if err != nil {
-					log.Fatal(err)
-				}
-				shaz := string(b)
-				results = append(results, shaz)
-			} else {
-				//record zeros?
-				results = append(results, 0.0)
-				results = append(results, 0.0)
-				results = append(results, "no hazard")
+		startTime = t
+	}
+	for i := range hpis {
+		hpis[i].StartTime = startTime
+	}
+	for _, ds := range frequencyGridDatasources {
+		pathString := attributes.GetStringOrDefault(ds.key, "")
+		if pathString == "" {
+			if ds.required {
+				return hpis, errors.New(ds.key + " is required")
 			}
+			continue
 		}
-		results[15] = firstProb
-		sEAD := ComputeEAD(sEADs, freqs) //use compute special ead to not create triangle below the most frequent event
-		results[12] = sEAD
-		cEAD := ComputeEAD(cEADs, freqs) //use compute special ead to not create triangle below the most frequent event
-		results[13] = cEAD
-		results[14] = sEAD + cEAD
-		var ret = consequences.Result{Headers: header, Result: results}
-		if gotWet {
-			w.Write(ret)
+		// grid paths expected to be comma separated variables of string path parts
+		paths := strings.Split(pathString, ", ")
+		if len(paths) != frequencyCount {
+			return hpis, errors.New(ds.key + " have different numbers of paths than the frequencies list")
 		}
-
-	})
-
-}
-
-// ComputeEAD integrates under the damage frequency curve but does calculate the first triangle between 1 and the first frequency.
-func ComputeEAD(damages []float64, freq []float64) float64 {
-	//this differs from computeEAD in that it specifically does calculate the first triangle between 1 and the first frequency to interpolate damages to zero.
-	if len(damages) != len(freq) {
-		panic("frequency curve is unbalanced")
-	}
-	triangle := 0.0
-	square := 0.0
-	x1 := freq[0]
-	y1 := damages[0]
-	eadT := 0.0
-	if len(damages) > 1 {
-		for i := 1; i < len(freq); i++ {
-			xdelta := x1 - freq[i]
-			square = xdelta * y1
-			if square != 0.0 { //we dont know where damage really begins until we see it. we can guess it is inbetween ordinates, but who knows.
-				triangle = ((xdelta) * -(y1 - damages[i])) / 2.0
-			} else {
-				triangle = ((xdelta) * -(y1 - damages[i])) / 2.0
-			}
-			eadT += square + triangle
-			x1 = freq[i]
-			y1 = damages[i]
+		for i, path := range paths {
+			hpis[i].Hazards = append(hpis[i].Hazards, hazardproviders.HazardProviderParameterAndPath{Hazard: ds.parameter, FilePath: path})
 		}
 	}
-	if x1 != 0.0 {
-		xdelta := x1 - 0.0
-		eadT += xdelta * y1 //no extrapolation, just continue damages out as if it were truth for all remaining probability.
-	}
-	return eadT
+	return hpis, nil
 }
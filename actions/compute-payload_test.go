@@ -1,5 +1,13 @@
 package actions
 
+import (
+	"testing"
+	"time"
+
+	"github.com/USACE/go-consequences/hazards"
+	"github.com/usace-cloud-compute/cc-go-sdk"
+)
+
 /*
 import (
 	"fmt"
@@ -119,3 +127,36 @@ func Test_ComputeFEMAMultiFrequency_SingleParameter(t *testing.T) {
 	}
 }
 */
+
+func Test_FrequencyGridsIncludeOptionalParameters(t *testing.T) {
+	attributes := cc.PayloadAttributes{
+		DepthGridPathsKey:       "d1, d2",
+		VelocityGridPathsKey:    "v1, v2",
+		DurationGridPathsKey:    "du1, du2",
+		ArrivalTimeGridPathsKey: "a1, a2",
+		arrivalStartTimeKey:     "2024-01-01T00:00:00Z",
+	}
+	hpis, err := readFrequencyGrids(attributes, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second := hpis[1].Hazards
+	if len(second) != 4 || second[0].Hazard != hazards.Depth || second[0].FilePath != "d2" || second[2].Hazard != hazards.Duration || second[2].FilePath != "du2" || second[3].Hazard != hazards.ArrivalTime {
+		t.Errorf("expected depth, velocity, duration and arrival time grids for the second frequency, got %v", second)
+	}
+	if !hpis[0].StartTime.Equal(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected the arrival start time on every frequency, got %v", hpis[0].StartTime)
+	}
+	_, err = readFrequencyGrids(cc.PayloadAttributes{VelocityGridPathsKey: "v1, v2"}, 2)
+	if err == nil {
+		t.Error("expected an error without depth grids")
+	}
+	_, err = readFrequencyGrids(cc.PayloadAttributes{DepthGridPathsKey: "d1, d2", "velocity-grid": "v1, v2"}, 2)
+	if err == nil {
+		t.Error("expected an error without velocity grids")
+	}
+	_, err = readFrequencyGrids(attributes, 3)
+	if err == nil {
+		t.Error("expected an error when the grids do not match the frequencies")
+	}
+}
@@ -0,0 +1,62 @@
+package actions
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+)
+
+const (
+	damageCategoryDimension string = "damage_category"
+	occupancyTypeDimension  string = "occupancy_type"
+	unknownBreakdownKey     string = "unknown" //structures without a value for a dimension that other structures carry
+	eventBreakdownHeader    string = "block_id,event_id,dimension,key,total_damage\n"
+)
+
+// breakdownKeys returns the sorted keys of a breakdown, it is empty when the source column was not present in the compute outputs.
+func breakdownKeys(values map[string]float64) []string {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	if len(keys) == 1 && keys[0] == "" {
+		return []string{}
+	}
+	sort.Strings(keys)
+	return keys
+}
+func breakdownLabel(key string) string {
+	if key == "" {
+		return unknownBreakdownKey
+	}
+	return key
+}
+
+// writeAALBreakdown writes the watershed aal for each damage category and occupancy type.
+func writeAALBreakdown(output io.Writer, curve WatershedCurve) error {
+	w := bufio.NewWriter(output)
+	w.WriteString("dimension,key,aal\n")
+	for _, k := range breakdownKeys(curve.CategoryAAL) {
+		w.WriteString(fmt.Sprintf("%v,%v,%.2f\n", damageCategoryDimension, breakdownLabel(k), curve.CategoryAAL[k]))
+	}
+	for _, k := range breakdownKeys(curve.OccupancyAAL) {
+		w.WriteString(fmt.Sprintf("%v,%v,%.2f\n", occupancyTypeDimension, breakdownLabel(k), curve.OccupancyAAL[k]))
+	}
+	return w.Flush()
+}
+
+// writeEventBreakdown writes the total damage of each event for each damage category and occupancy type in long format,
+// the eventBreakdownHeader is written once before the first block.
+func writeEventBreakdown(output io.Writer, events []EventDamage) error {
+	w := bufio.NewWriter(output)
+	for _, e := range events {
+		for _, k := range breakdownKeys(e.CategoryDamage) {
+			w.WriteString(fmt.Sprintf("%v,%v,%v,%v,%.2f\n", e.BlockNumber, e.EventNumber, damageCategoryDimension, breakdownLabel(k), e.CategoryDamage[k]))
+		}
+		for _, k := range breakdownKeys(e.OccupancyDamage) {
+			w.WriteString(fmt.Sprintf("%v,%v,%v,%v,%.2f\n", e.BlockNumber, e.EventNumber, occupancyTypeDimension, breakdownLabel(k), e.OccupancyDamage[k]))
+		}
+	}
+	return w.Flush()
+}
@@ -0,0 +1,50 @@
+package actions
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_DamageBreakdown(t *testing.T) {
+	accumulation := accumulateSyntheticBlocks(t, BlockMaximum)
+	structures := accumulation.frequencyResults(t)
+	if structures["a"].DamageCategory != "RES" || structures["b"].OccupancyType != "COM1" {
+		t.Errorf("expected damage category and occupancy type to survive the spill, got %v and %v", structures["a"].DamageCategory, structures["b"].OccupancyType)
+	}
+	curve := buildWatershedCurve(1, accumulation.accumulator.WatershedBlockTotals(), 3, Weibull)
+	sb := strings.Builder{}
+	err := writeAALBreakdown(&sb, curve)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "dimension,key,aal\ndamage_category,COM,22.50\ndamage_category,RES,19.00\noccupancy_type,COM1,22.50\noccupancy_type,RES1-1SNB,19.00\n"
+	if sb.String() != expected {
+		t.Errorf("expected %v, got %v", expected, sb.String())
+	}
+	events := accumulation.events
+	if len(events) != 6 {
+		t.Fatalf("expected 6 events, got %v", len(events))
+	}
+	sb.Reset()
+	sb.WriteString(eventBreakdownHeader)
+	err = writeEventBreakdown(&sb, events[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = "block_id,event_id,dimension,key,total_damage\n1,1,damage_category,COM,7.50\n1,1,damage_category,RES,15.00\n1,1,occupancy_type,COM1,7.50\n1,1,occupancy_type,RES1-1SNB,15.00\n"
+	if sb.String() != expected {
+		t.Errorf("expected %v, got %v", expected, sb.String())
+	}
+}
+
+func Test_DamageBreakdownWithoutSourceColumns(t *testing.T) {
+	sb := strings.Builder{}
+	sb.WriteString(eventBreakdownHeader)
+	err := writeEventBreakdown(&sb, []EventDamage{{BlockNumber: 1, EventNumber: 1, TotalDamage: 5, CategoryDamage: map[string]float64{"": 5}, OccupancyDamage: map[string]float64{"": 5}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sb.String() != "block_id,event_id,dimension,key,total_damage\n" {
+		t.Errorf("expected no breakdown rows when the source columns are missing, got %v", sb.String())
+	}
+}
@@ -0,0 +1,122 @@
+package actions
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// knownAnswerBlocks is a ten block realization where blocks 3 and 8 have no events.
+var knownAnswerBlocks = Blocks{
+	{RealizationIndex: 1, BlockIndex: 1, BlockEventCount: 2, BlockEventStart: 1, BlockEventEnd: 2},
+	{RealizationIndex: 1, BlockIndex: 2, BlockEventCount: 2, BlockEventStart: 3, BlockEventEnd: 4},
+	{RealizationIndex: 1, BlockIndex: 3, BlockEventCount: 0, BlockEventStart: 5, BlockEventEnd: 4},
+	{RealizationIndex: 1, BlockIndex: 4, BlockEventCount: 1, BlockEventStart: 5, BlockEventEnd: 5},
+	{RealizationIndex: 1, BlockIndex: 5, BlockEventCount: 1, BlockEventStart: 6, BlockEventEnd: 6},
+	{RealizationIndex: 1, BlockIndex: 6, BlockEventCount: 1, BlockEventStart: 7, BlockEventEnd: 7},
+	{RealizationIndex: 1, BlockIndex: 7, BlockEventCount: 2, BlockEventStart: 8, BlockEventEnd: 9},
+	{RealizationIndex: 1, BlockIndex: 8, BlockEventCount: 0, BlockEventStart: 10, BlockEventEnd: 9},
+	{RealizationIndex: 1, BlockIndex: 9, BlockEventCount: 1, BlockEventStart: 10, BlockEventEnd: 10},
+	{RealizationIndex: 1, BlockIndex: 10, BlockEventCount: 2, BlockEventStart: 11, BlockEventEnd: 12},
+}
+
+// knownAnswerEvents holds the structure rows of each event, events not listed have an output with no rows.
+// s is damaged in blocks 2 and 7 and has a dry row in block 5, w is only damaged in the last block.
+// DAEP counts every block with a row, dry or not, so s has a DAEP of 0.3.
+var knownAnswerEvents = map[int64][]ConsequenceResult{
+	4:  {{Fdid: "s", StructDamage: 100, Depth: 2}},
+	6:  {{Fdid: "s", StructDamage: 0, Depth: 0}},
+	9:  {{Fdid: "s", StructDamage: 50, Depth: 1}},
+	12: {{Fdid: "w", StructDamage: 20, Depth: 0.5}},
+}
+
+func readKnownAnswerEvent(path string) ([]ConsequenceResult, string, error) {
+	event, _ := strconv.ParseInt(strings.TrimSuffix(path, ".gpkg"), 10, 64)
+	results := make([]ConsequenceResult, len(knownAnswerEvents[event]))
+	copy(results, knownAnswerEvents[event])
+	return results, "", nil
+}
+
+func accumulateKnownAnswer(t *testing.T) (*BlockAccumulator, int, []int32) {
+	accumulator := InitBlockAccumulator(BlockMaximum)
+	err := accumulator.SetSpillDirectory(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { accumulator.Close() })
+	handled := make([]int32, 0)
+	accumulator.SetBlockHandler(func(block int32, results []ConsequencesBlockResult) error {
+		handled = append(handled, block)
+		return nil
+	})
+	report, err := validateBlockManifest(knownAnswerBlocks, 1, StrictValidation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blockCount, _, err := accumulateRealization(knownAnswerBlocks, 1, "%v.gpkg", 3, readKnownAnswerEvent, report, accumulator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return accumulator, blockCount, handled
+}
+
+func Test_DryBlocksAreIncluded(t *testing.T) {
+	accumulator, blockCount, handled := accumulateKnownAnswer(t)
+	if blockCount != 10 {
+		t.Fatalf("expected 10 blocks, got %v", blockCount)
+	}
+	//every block, including the last and those without events, is written in order.
+	if len(handled) != 10 {
+		t.Fatalf("expected all 10 blocks to be handled, got %v", handled)
+	}
+	for i, b := range handled {
+		if b != int32(i+1) {
+			t.Errorf("expected block %v at position %v, got %v", i+1, i, b)
+		}
+	}
+	totals := accumulator.WatershedBlockTotals()
+	if len(totals) != 10 || totals[9].TotalDamage != 20 || totals[2].TotalDamage != 0 || totals[2].DrivingEvent.EventNumber != 0 {
+		t.Errorf("unexpected watershed block totals %v", totals)
+	}
+}
+
+func Test_KnownAnswerAAL(t *testing.T) {
+	accumulator, blockCount, _ := accumulateKnownAnswer(t)
+	expected := map[string]ConsequencesFrequencyResult{
+		"s": {SAAL: 15, TAAL: 15, DAEP: 0.3},
+		"w": {SAAL: 2, TAAL: 2, DAEP: 0.1},
+	}
+	count := 0
+	err := accumulator.EachStructure(func(v ConsequencesFrequencyResult) error {
+		count++
+		if len(v.TotalDamage) != blockCount {
+			t.Errorf("expected %v zero filled blocks for %v, got %v", blockCount, v.Fdid, len(v.TotalDamage))
+		}
+		v = computeFrequencyAAL(v, blockCount, blockCount)
+		e := expected[v.Fdid]
+		if math.Abs(v.SAAL-e.SAAL) > 1e-9 || math.Abs(v.TAAL-e.TAAL) > 1e-9 || math.Abs(v.DAEP-e.DAEP) > 1e-9 {
+			t.Errorf("expected %v to have SAAL %v, TAAL %v and DAEP %v, got %v, %v and %v", v.Fdid, e.SAAL, e.TAAL, e.DAEP, v.SAAL, v.TAAL, v.DAEP)
+		}
+		//the ordinate cap is zero based and inclusive, a cap of one keeps the two largest blocks and a cap of zero the largest.
+		capped := computeFrequencyAAL(v, blockCount, 1)
+		if want := (v.TotalDamage[0].Value + v.TotalDamage[1].Value) / 10; math.Abs(capped.TAAL-want) > 1e-9 {
+			t.Errorf("expected a capped TAAL of %v for %v, got %v", want, v.Fdid, capped.TAAL)
+		}
+		capped = computeFrequencyAAL(v, blockCount, 0)
+		if want := v.TotalDamage[0].Value / 10; math.Abs(capped.TAAL-want) > 1e-9 {
+			t.Errorf("expected a TAAL of %v for %v with a cap of zero, got %v", want, v.Fdid, capped.TAAL)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("expected 2 structures, got %v", count)
+	}
+	curve := buildWatershedCurve(1, accumulator.WatershedBlockTotals(), blockCount, Weibull)
+	if len(curve.Ordinates) != 10 || curve.AAL != 17 {
+		t.Errorf("expected 10 ordinates and a watershed aal of 17, got %v and %v", len(curve.Ordinates), curve.AAL)
+	}
+}
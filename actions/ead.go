@@ -0,0 +1,132 @@
+package actions
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/usace-cloud-compute/cc-go-sdk"
+)
+
+const (
+	eadMethodKey      string = "eadMethod"      //optional, trapezoid or special.
+	eadTriangleKey    string = "eadTriangle"    //optional, true to add the triangle from the damage begin aep to the most frequent event. defaults to false.
+	damageBeginAEPKey string = "damageBeginAEP" //optional, the aep damage begins at for the triangle. defaults to 1.
+	eadTailKey        string = "eadTail"        //optional, constant, none or log-linear. defaults to constant.
+)
+
+// EADMethod is how damages are interpolated between two frequencies.
+type EADMethod string
+
+const (
+	TrapezoidEAD EADMethod = "trapezoid" //linear between every pair of frequencies
+	SpecialEAD   EADMethod = "special"   //linear, except damage is not interpolated into an interval whose more frequent event is dry
+)
+
+// EADTail is how damages are extended beyond the rarest frequency.
+type EADTail string
+
+const (
+	ConstantTail  EADTail = "constant"   //the rarest damage holds for all remaining probability
+	NoTail        EADTail = "none"       //no damage beyond the rarest frequency
+	LogLinearTail EADTail = "log-linear" //damage continues to grow linearly with the log of the aep of the two rarest frequencies
+)
+
+// EADOptions configure the integration of a damage-frequency curve into an expected annual damage.
+type EADOptions struct {
+	Method         EADMethod
+	Triangle       bool
+	DamageBeginAEP float64
+	Tail           EADTail
+}
+
+// initEADOptions reads the integration attributes, the method defaults to the method the action has always used.
+func initEADOptions(attributes cc.PayloadAttributes, defaultMethod EADMethod) (EADOptions, error) {
+	o := EADOptions{
+		Method:         EADMethod(attributes.GetStringOrDefault(eadMethodKey, string(defaultMethod))),
+		DamageBeginAEP: attributes.GetFloatOrDefault(damageBeginAEPKey, 1),
+		Tail:           EADTail(attributes.GetStringOrDefault(eadTailKey, string(ConstantTail))),
+		Triangle:       attributes.GetBooleanOrDefault(eadTriangleKey, false),
+	}
+	return o, o.Validate()
+}
+
+func (o EADOptions) Validate() error {
+	if o.Method != TrapezoidEAD && o.Method != SpecialEAD {
+		return errors.New("unknown ead method " + string(o.Method) + ", expected trapezoid or special")
+	}
+	if o.Tail != ConstantTail && o.Tail != NoTail && o.Tail != LogLinearTail {
+		return errors.New("unknown ead tail " + string(o.Tail) + ", expected constant, none or log-linear")
+	}
+	if o.Triangle && (o.DamageBeginAEP <= 0 || o.DamageBeginAEP > 1) {
+		return errors.New("the damage begin aep must be greater than 0 and at most 1")
+	}
+	return nil
+}
+
+// sortFrequencies returns the frequencies from most to least frequent and the original index of each,
+// frequencies must be greater than 0, at most 1 and unique.
+func sortFrequencies(freqs []float64) ([]float64, []int, error) {
+	order := make([]int, len(freqs))
+	for i, f := range freqs {
+		if f <= 0 || f > 1 {
+			return nil, nil, fmt.Errorf("frequencies must be greater than 0 and at most 1, got %v", f)
+		}
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return freqs[order[i]] > freqs[order[j]] })
+	sorted := make([]float64, len(freqs))
+	for i, o := range order {
+		sorted[i] = freqs[o]
+		if i > 0 && sorted[i] == sorted[i-1] {
+			return nil, nil, fmt.Errorf("the frequency %v is repeated", sorted[i])
+		}
+	}
+	return sorted, order, nil
+}
+
+// Integrate returns the expected annual damage of a damage-frequency curve, the ordinates may be in any order.
+func (o EADOptions) Integrate(damages []float64, freqs []float64) (float64, error) {
+	if len(damages) != len(freqs) {
+		return 0, fmt.Errorf("the frequency curve is unbalanced, %v damages and %v frequencies", len(damages), len(freqs))
+	}
+	if len(freqs) == 0 {
+		return 0, nil
+	}
+	sorted, order, err := sortFrequencies(freqs)
+	if err != nil {
+		return 0, err
+	}
+	d := make([]float64, len(damages))
+	for i, idx := range order {
+		d[i] = damages[idx]
+	}
+	ead := 0.0
+	if o.Triangle {
+		if o.DamageBeginAEP < sorted[0] {
+			return 0, fmt.Errorf("the damage begin aep %v is rarer than the most frequent event %v", o.DamageBeginAEP, sorted[0])
+		}
+		ead += (o.DamageBeginAEP - sorted[0]) * d[0] / 2
+	}
+	for i := 1; i < len(sorted); i++ {
+		if o.Method == SpecialEAD && d[i-1] == 0 {
+			//we dont know where damage really begins until we see it.
+			continue
+		}
+		ead += (sorted[i-1] - sorted[i]) * (d[i-1] + d[i]) / 2
+	}
+	last := len(sorted) - 1
+	switch o.Tail {
+	case ConstantTail:
+		ead += sorted[last] * d[last]
+	case LogLinearTail:
+		//integrating d + b*(ln(p) - ln(f)) from 0 to f gives f*(d - b), damage is not extrapolated to decrease.
+		slope := 0.0
+		if last > 0 {
+			slope = math.Min(0, (d[last-1]-d[last])/(math.Log(sorted[last-1])-math.Log(sorted[last])))
+		}
+		ead += sorted[last] * (d[last] - slope)
+	}
+	return ead, nil
+}
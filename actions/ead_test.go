@@ -0,0 +1,74 @@
+package actions
+
+import (
+	"math"
+	"testing"
+
+	"github.com/USACE/go-consequences/compute"
+)
+
+func Test_EADMatchesLegacyIntegration(t *testing.T) {
+	freqs := []float64{0.1, 0.04, 0.02, 0.01, 0.005, 0.002}
+	damages := []float64{0, 0, 10, 40, 60, 90}
+	special, err := EADOptions{Method: SpecialEAD, Tail: ConstantTail}.Integrate(damages, freqs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(special-compute.ComputeSpecialEAD(damages, freqs)) > 1e-12 {
+		t.Errorf("expected the special method to match go-consequences, got %v and %v", special, compute.ComputeSpecialEAD(damages, freqs))
+	}
+	trapezoid, err := EADOptions{Method: TrapezoidEAD, Tail: ConstantTail}.Integrate(damages, freqs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//the trapezoid method also interpolates damage from the dry 50 year event to the 100 year event.
+	if math.Abs(trapezoid-special-0.1) > 1e-12 {
+		t.Errorf("expected the trapezoid method to add 0.1 to %v, got %v", special, trapezoid)
+	}
+}
+
+func Test_EADTriangleTailAndOrdering(t *testing.T) {
+	freqs := []float64{0.01, 0.1}
+	damages := []float64{100, 20}
+	o := EADOptions{Method: TrapezoidEAD, Tail: NoTail}
+	ead, err := o.Integrate(damages, freqs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(ead-5.4) > 1e-12 {
+		t.Errorf("expected unsorted frequencies to integrate to 5.4, got %v", ead)
+	}
+	o.Triangle = true
+	o.DamageBeginAEP = 0.5
+	ead, err = o.Integrate(damages, freqs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(ead-9.4) > 1e-12 {
+		t.Errorf("expected a triangle of 4 from an aep of 0.5, got %v", ead)
+	}
+	o = EADOptions{Method: TrapezoidEAD, Tail: LogLinearTail}
+	ead, err = o.Integrate(damages, freqs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//the slope is -80/ln(10) per unit of ln(aep) so the tail is 0.01*(100+80/ln(10)).
+	expected := 5.4 + 0.01*(100+80/math.Log(10))
+	if math.Abs(ead-expected) > 1e-12 {
+		t.Errorf("expected a log-linear tail integrating to %v, got %v", expected, ead)
+	}
+	_, err = o.Integrate([]float64{1}, freqs)
+	if err == nil {
+		t.Error("expected an error for an unbalanced curve")
+	}
+	_, err = o.Integrate(damages, []float64{0.1, 0.1})
+	if err == nil {
+		t.Error("expected an error for a repeated frequency")
+	}
+	o.Triangle = true
+	o.DamageBeginAEP = 0.05
+	_, err = o.Integrate(damages, freqs)
+	if err == nil {
+		t.Error("expected an error for a damage begin aep rarer than the most frequent event")
+	}
+}
@@ -0,0 +1,224 @@
+package actions
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+
+	"github.com/usace-cloud-compute/cc-go-sdk"
+)
+
+const (
+	discountRateKey             string = "discountRate"             //annual rate as a fraction, e.g. 0.025
+	periodOfAnalysisKey         string = "periodOfAnalysis"         //years
+	baseYearKey                 string = "baseYear"                 //the first year of the period of analysis
+	futureYearKey               string = "futureYear"               //optional, the year the future condition aal is reached. defaults to the last year of the period of analysis.
+	futureFrequencyFilePathKey  string = "futureFrequencyFilePath"  //optional, summarize-outputs-to-frequency csv for the future condition
+	frequencyFilePathKey        string = "frequencyFilePath"        //summarize-outputs-to-frequency csv for the base year condition
+	economicsCsvFilePathKey     string = "economicsCsvFilePath"     //per structure equivalent annual damages and present values
+	economicsSummaryFilePathKey string = "economicsSummaryFilePath" //aggregate equivalent annual damages and present values
+	discountAALActionName       string = "discount-aal"
+)
+
+func init() {
+	cc.ActionRegistry.RegisterAction(discountAALActionName, &DiscountAALAction{})
+}
+
+// DiscountAALAction converts base year and future condition aal into equivalent annual damages and present values.
+type DiscountAALAction struct {
+	cc.ActionRunnerBase
+}
+
+// EconomicParameters describe the period of analysis used to discount aal.
+type EconomicParameters struct {
+	DiscountRate     float64
+	PeriodOfAnalysis int
+	BaseYear         int
+	FutureYear       int //the year the future condition aal is reached, aal is interpolated linearly from the base year and held constant after.
+}
+
+// Validate checks that the parameters describe a usable period of analysis.
+func (ep EconomicParameters) Validate() error {
+	if ep.DiscountRate < 0 {
+		return errors.New("the discount rate must not be negative")
+	}
+	if ep.PeriodOfAnalysis < 1 {
+		return errors.New("the period of analysis must be at least one year")
+	}
+	if ep.FutureYear < ep.BaseYear {
+		return errors.New("the future year must not be before the base year")
+	}
+	return nil
+}
+
+// CapitalRecoveryFactor converts a present value into an equal payment at the end of each year of the period of analysis.
+func (ep EconomicParameters) CapitalRecoveryFactor() float64 {
+	n := float64(ep.PeriodOfAnalysis)
+	if ep.DiscountRate == 0 {
+		return 1 / n
+	}
+	growth := math.Pow(1+ep.DiscountRate, n)
+	return ep.DiscountRate * growth / (growth - 1)
+}
+
+// AALInYear returns the aal in a year of the period of analysis, year 1 is the base year.
+func (ep EconomicParameters) AALInYear(year int, baseAAL float64, futureAAL float64) float64 {
+	span := ep.FutureYear - ep.BaseYear
+	if span <= 0 {
+		//the future condition is reached in the base year.
+		return futureAAL
+	}
+	fraction := math.Min(float64(year-1)/float64(span), 1)
+	return baseAAL + (futureAAL-baseAAL)*fraction
+}
+
+// PresentValue discounts the aal of each year of the period of analysis to the base year, damages occur at the end of each year.
+func (ep EconomicParameters) PresentValue(baseAAL float64, futureAAL float64) float64 {
+	pv := 0.0
+	for year := 1; year <= ep.PeriodOfAnalysis; year++ {
+		pv += ep.AALInYear(year, baseAAL, futureAAL) / math.Pow(1+ep.DiscountRate, float64(year))
+	}
+	return pv
+}
+
+// EquivalentAnnualDamage returns the equivalent annual damage and the present value of the damages over the period of analysis.
+func (ep EconomicParameters) EquivalentAnnualDamage(baseAAL float64, futureAAL float64) (float64, float64) {
+	pv := ep.PresentValue(baseAAL, futureAAL)
+	return pv * ep.CapitalRecoveryFactor(), pv
+}
+
+// StructureEconomics is the discounted damage of a single structure.
+type StructureEconomics struct {
+	Fdid         string
+	X            float64
+	Y            float64
+	BaseAAL      float64
+	FutureAAL    float64
+	EqAD         float64 //equivalent annual damage
+	PresentValue float64
+}
+
+// discountStructures merges the base and optional future frequency files by fd_id and discounts each structure's total aal.
+// without a future condition the base year aal is used for every year. a structure missing from a condition was never wet in it.
+func discountStructures(base *frequencyFileReader, future *frequencyFileReader, parameters EconomicParameters, yield func(s StructureEconomics) error) (StructureEconomics, error) {
+	readers := []*frequencyFileReader{base}
+	if future != nil {
+		readers = append(readers, future)
+	}
+	total := StructureEconomics{Fdid: "total"}
+	for {
+		fdid := ""
+		var x, y float64
+		for _, r := range readers {
+			if r.err != nil {
+				return total, r.err
+			}
+			if r.next != nil && (fdid == "" || r.next.Fdid < fdid) {
+				fdid, x, y = r.next.Fdid, r.next.X, r.next.Y
+			}
+		}
+		if fdid == "" {
+			break
+		}
+		taal := make([]float64, len(readers))
+		for i, r := range readers {
+			if r.next == nil || r.next.Fdid != fdid {
+				continue
+			}
+			taal[i] = r.next.TAAL
+			r.advance()
+		}
+		s := StructureEconomics{Fdid: fdid, X: x, Y: y, BaseAAL: taal[0], FutureAAL: taal[0]}
+		if future != nil {
+			s.FutureAAL = taal[1]
+		}
+		s.EqAD, s.PresentValue = parameters.EquivalentAnnualDamage(s.BaseAAL, s.FutureAAL)
+		total.BaseAAL += s.BaseAAL
+		total.FutureAAL += s.FutureAAL
+		total.EqAD += s.EqAD
+		total.PresentValue += s.PresentValue
+		err := yield(s)
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+func writeStructureEconomicsRow(w *bufio.Writer, s StructureEconomics) error {
+	_, err := w.WriteString(fmt.Sprintf("%v,%v,%v,%.2f,%.2f,%.2f,%.2f\n", s.Fdid, s.X, s.Y, s.BaseAAL, s.FutureAAL, s.EqAD, s.PresentValue))
+	return err
+}
+
+// writeEconomicsSummary writes the parameters and the aggregate results as metric,value rows.
+func writeEconomicsSummary(output io.Writer, parameters EconomicParameters, total StructureEconomics) error {
+	w := bufio.NewWriter(output)
+	w.WriteString("metric,value\n")
+	w.WriteString(fmt.Sprintf("discount_rate,%v\n", parameters.DiscountRate))
+	w.WriteString(fmt.Sprintf("period_of_analysis,%v\n", parameters.PeriodOfAnalysis))
+	w.WriteString(fmt.Sprintf("base_year,%v\n", parameters.BaseYear))
+	w.WriteString(fmt.Sprintf("future_year,%v\n", parameters.FutureYear))
+	w.WriteString(fmt.Sprintf("capital_recovery_factor,%.6f\n", parameters.CapitalRecoveryFactor()))
+	w.WriteString(fmt.Sprintf("base_aal,%.2f\n", total.BaseAAL))
+	w.WriteString(fmt.Sprintf("future_aal,%.2f\n", total.FutureAAL))
+	w.WriteString(fmt.Sprintf("eqad,%.2f\n", total.EqAD))
+	w.WriteString(fmt.Sprintf("present_value,%.2f\n", total.PresentValue))
+	return w.Flush()
+}
+
+func (ar *DiscountAALAction) Run() error {
+	a := ar.Action
+	frequencyFilePath := a.Attributes.GetStringOrFail(frequencyFilePathKey)
+	futureFrequencyFilePath := a.Attributes.GetStringOrDefault(futureFrequencyFilePathKey, "")
+	csvFilePath := a.Attributes.GetStringOrFail(economicsCsvFilePathKey)
+	summaryFilePath := a.Attributes.GetStringOrFail(economicsSummaryFilePathKey)
+	parameters := EconomicParameters{
+		DiscountRate:     a.Attributes.GetFloatOrFail(discountRateKey),
+		PeriodOfAnalysis: a.Attributes.GetIntOrFail(periodOfAnalysisKey),
+		BaseYear:         a.Attributes.GetIntOrFail(baseYearKey),
+	}
+	parameters.FutureYear = a.Attributes.GetIntOrDefault(futureYearKey, parameters.BaseYear+parameters.PeriodOfAnalysis-1)
+	err := parameters.Validate()
+	if err != nil {
+		return err
+	}
+	base, err := openFrequencyFile(frequencyFilePath)
+	if err != nil {
+		return err
+	}
+	defer base.Close()
+	var future *frequencyFileReader
+	if futureFrequencyFilePath != "" {
+		future, err = openFrequencyFile(futureFrequencyFilePath)
+		if err != nil {
+			return err
+		}
+		defer future.Close()
+	}
+	csvFile, err := os.Create(csvFilePath)
+	if err != nil {
+		return err
+	}
+	defer csvFile.Close()
+	w := bufio.NewWriter(csvFile)
+	w.WriteString("fd_id,x,y,base_aal,future_aal,eqad,present_value\n")
+	total, err := discountStructures(base, future, parameters, func(s StructureEconomics) error {
+		return writeStructureEconomicsRow(w, s)
+	})
+	if err != nil {
+		return err
+	}
+	err = w.Flush()
+	if err != nil {
+		return err
+	}
+	summaryFile, err := os.Create(summaryFilePath)
+	if err != nil {
+		return err
+	}
+	defer summaryFile.Close()
+	return writeEconomicsSummary(summaryFile, parameters, total)
+}
@@ -0,0 +1,81 @@
+package actions
+
+import (
+	"bufio"
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_EquivalentAnnualDamageConstant(t *testing.T) {
+	parameters := EconomicParameters{DiscountRate: 0.025, PeriodOfAnalysis: 50, BaseYear: 2030, FutureYear: 2030}
+	eqad, pv := parameters.EquivalentAnnualDamage(100, 100)
+	//the present value of an annuity of 100 for 50 years at 2.5 percent.
+	expectedPV := 100 * (1 - math.Pow(1.025, -50)) / 0.025
+	if math.Abs(pv-expectedPV) > 1e-6 || math.Abs(eqad-100) > 1e-9 {
+		t.Errorf("expected an eqad of 100 and a present value of %v, got %v and %v", expectedPV, eqad, pv)
+	}
+}
+
+func Test_EquivalentAnnualDamageFutureInBaseYear(t *testing.T) {
+	parameters := EconomicParameters{DiscountRate: 0, PeriodOfAnalysis: 10, BaseYear: 2030, FutureYear: 2030}
+	if parameters.AALInYear(1, 100, 200) != 200 {
+		t.Errorf("expected the future aal in the base year, got %v", parameters.AALInYear(1, 100, 200))
+	}
+	eqad, pv := parameters.EquivalentAnnualDamage(100, 200)
+	if math.Abs(pv-2000) > 1e-9 || math.Abs(eqad-200) > 1e-9 {
+		t.Errorf("expected an eqad of 200 and a present value of 2000, got %v and %v", eqad, pv)
+	}
+}
+
+func Test_EquivalentAnnualDamageFutureCondition(t *testing.T) {
+	//aal grows from 100 in 2030 to 200 in 2040 and holds for the rest of the 20 year period.
+	parameters := EconomicParameters{DiscountRate: 0, PeriodOfAnalysis: 20, BaseYear: 2030, FutureYear: 2040}
+	if parameters.AALInYear(6, 100, 200) != 150 || parameters.AALInYear(15, 100, 200) != 200 {
+		t.Errorf("unexpected interpolated aal %v and %v", parameters.AALInYear(6, 100, 200), parameters.AALInYear(15, 100, 200))
+	}
+	eqad, pv := parameters.EquivalentAnnualDamage(100, 200)
+	if math.Abs(pv-3450) > 1e-9 || math.Abs(eqad-172.5) > 1e-9 {
+		t.Errorf("expected an eqad of 172.5 and a present value of 3450, got %v and %v", eqad, pv)
+	}
+	err := EconomicParameters{DiscountRate: 0.03, PeriodOfAnalysis: 0}.Validate()
+	if err == nil {
+		t.Errorf("expected a period of analysis of zero to be rejected")
+	}
+}
+
+func Test_DiscountStructures(t *testing.T) {
+	dir := t.TempDir()
+	basePath, futurePath := filepath.Join(dir, "base.csv"), filepath.Join(dir, "future.csv")
+	writeRealizationFrequencyFile(t, basePath, []realizationStructure{{Fdid: "a", TAAL: 100}, {Fdid: "b", TAAL: 10}})
+	writeRealizationFrequencyFile(t, futurePath, []realizationStructure{{Fdid: "a", TAAL: 200}})
+	base, err := openFrequencyFile(basePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer base.Close()
+	future, err := openFrequencyFile(futurePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer future.Close()
+	parameters := EconomicParameters{DiscountRate: 0, PeriodOfAnalysis: 20, BaseYear: 2030, FutureYear: 2040}
+	sb := strings.Builder{}
+	w := bufio.NewWriter(&sb)
+	total, err := discountStructures(base, future, parameters, func(s StructureEconomics) error {
+		return writeStructureEconomicsRow(w, s)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Flush()
+	//b is dry in the future condition so its aal falls to zero by 2040.
+	expected := "a,1,2,100.00,200.00,172.50,3450.00\nb,1,2,10.00,0.00,2.75,55.00\n"
+	if sb.String() != expected {
+		t.Errorf("expected %v, got %v", expected, sb.String())
+	}
+	if math.Abs(total.EqAD-175.25) > 1e-9 || math.Abs(total.PresentValue-3505) > 1e-9 {
+		t.Errorf("unexpected totals %v", total)
+	}
+}
@@ -0,0 +1,103 @@
+package actions
+
+import (
+	"errors"
+	"fmt"
+)
+
+// defaultMaxOpenDatasets is the number of event outputs read at once when maxOpenDatasets is not provided.
+const defaultMaxOpenDatasets = 8
+
+// EventResults holds every structure row read from the compute output of a single event in a block.
+type EventResults struct {
+	Block   Block
+	Event   int64
+	Results []ConsequenceResult
+	Wkt     string
+}
+
+// eventReaderFunc reads all structure rows from a single event output, readEventResults is used outside of tests.
+type eventReaderFunc func(path string) ([]ConsequenceResult, string, error)
+
+func gdalEventReader(driver string, tablename string) eventReaderFunc {
+	return func(path string) ([]ConsequenceResult, string, error) {
+		results := make([]ConsequenceResult, 0)
+		wkt, err := readEventResults(path, driver, tablename, func(r ConsequenceResult) error {
+			results = append(results, r)
+			return nil
+		})
+		return results, wkt, err
+	}
+}
+
+// readRealizationEvents reads the events of every block in a realization concurrently with at most maxOpen outputs open or buffered at once.
+// events are yielded in block file order so reductions are reproducible, events that could not be opened are recorded in the report and skipped.
+func readRealizationEvents(blocks Blocks, realizationNumber int, resultPathPattern string, maxOpen int, read eventReaderFunc, report *ManifestReport, yield func(e EventResults) error) error {
+	if maxOpen < 1 {
+		return errors.New("the number of open datasets must be at least one")
+	}
+	type eventRead struct {
+		EventResults
+		err error
+	}
+	slots := make(chan struct{}, maxOpen)
+	pending := make(chan chan eventRead, maxOpen)
+	done := make(chan struct{})
+	go func() {
+		defer close(pending)
+		for _, b := range blocks {
+			if b.RealizationIndex != realizationNumber {
+				continue
+			}
+			for i := b.BlockEventStart; i <= b.BlockEventEnd; i++ {
+				//a slot is held from opening the dataset until the reducer has consumed its rows.
+				//the reducer frees slots after it fails, so done is checked first to stop opening datasets.
+				select {
+				case <-done:
+					return
+				default:
+				}
+				select {
+				case slots <- struct{}{}:
+				case <-done:
+					return
+				}
+				result := make(chan eventRead, 1)
+				pending <- result
+				go func(b Block, event int64) {
+					results, wkt, err := read(fmt.Sprintf(resultPathPattern, event))
+					for j := range results {
+						results[j].EventNumber = int32(event)
+						results[j].BlockNumber = int32(b.BlockIndex)
+						results[j].RealizationNumber = int32(realizationNumber)
+					}
+					result <- eventRead{EventResults: EventResults{Block: b, Event: event, Results: results, Wkt: wkt}, err: err}
+				}(b, i)
+			}
+		}
+	}()
+	var err error
+	for result := range pending {
+		e := <-result
+		<-slots
+		if err != nil {
+			continue
+		}
+		if e.err != nil {
+			if errors.Is(e.err, errEventResultNotFound) {
+				err = report.recordMissing(int32(e.Block.BlockIndex), e.Event, e.err)
+			} else {
+				err = e.err
+			}
+			if err != nil {
+				close(done)
+			}
+			continue
+		}
+		err = yield(e.EventResults)
+		if err != nil {
+			close(done)
+		}
+	}
+	return err
+}
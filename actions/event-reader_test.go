@@ -0,0 +1,104 @@
+package actions
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeEventReader returns one structure per event and records how many events are being read at once.
+type fakeEventReader struct {
+	mu      sync.Mutex
+	open    int
+	maxOpen int
+	reads   int
+	missing map[int64]bool
+}
+
+func (f *fakeEventReader) read(path string) ([]ConsequenceResult, string, error) {
+	event, _ := strconv.ParseInt(strings.TrimSuffix(strings.TrimPrefix(path, "events/"), ".gpkg"), 10, 64)
+	f.mu.Lock()
+	f.open++
+	f.reads++
+	if f.open > f.maxOpen {
+		f.maxOpen = f.open
+	}
+	f.mu.Unlock()
+	defer func() {
+		f.mu.Lock()
+		f.open--
+		f.mu.Unlock()
+	}()
+	//later events finish first to show the output order does not depend on read order.
+	time.Sleep(time.Duration(10-event%10) * time.Millisecond)
+	if f.missing[event] {
+		return nil, "", fmt.Errorf("%w: %v", errEventResultNotFound, path)
+	}
+	return []ConsequenceResult{{Fdid: "a", StructDamage: float64(event)}}, "wkt", nil
+}
+
+func syntheticBlocks() Blocks {
+	blocks := make(Blocks, 0)
+	event := int64(1)
+	for b := 1; b <= 5; b++ {
+		blocks = append(blocks, Block{RealizationIndex: 1, BlockIndex: b, BlockEventCount: 6, BlockEventStart: event, BlockEventEnd: event + 5})
+		event += 6
+	}
+	return blocks
+}
+
+func Test_ReadRealizationEventsInOrder(t *testing.T) {
+	reader := &fakeEventReader{missing: map[int64]bool{7: true}}
+	events := make([]int64, 0)
+	err := readRealizationEvents(syntheticBlocks(), 1, "events/%v.gpkg", 4, reader.read, nil, func(e EventResults) error {
+		if len(e.Results) != 1 || e.Results[0].EventNumber != int32(e.Event) || e.Results[0].BlockNumber != int32(e.Block.BlockIndex) {
+			t.Errorf("unexpected results for event %v: %v", e.Event, e.Results)
+		}
+		events = append(events, e.Event)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 29 {
+		t.Fatalf("expected 29 events with event 7 skipped, got %v", len(events))
+	}
+	for i := 1; i < len(events); i++ {
+		if events[i] <= events[i-1] {
+			t.Errorf("expected events in block file order, got %v after %v", events[i], events[i-1])
+		}
+	}
+	if reader.maxOpen > 4 {
+		t.Errorf("expected at most 4 open datasets, got %v", reader.maxOpen)
+	}
+	if reader.maxOpen < 2 {
+		t.Errorf("expected events to be read concurrently")
+	}
+}
+
+func Test_ReadRealizationEventsStopsOnError(t *testing.T) {
+	reader := &fakeEventReader{}
+	stop := errors.New("stop")
+	count := 0
+	err := readRealizationEvents(syntheticBlocks(), 1, "events/%v.gpkg", 3, reader.read, nil, func(e EventResults) error {
+		count++
+		if e.Event == 5 {
+			return stop
+		}
+		return nil
+	})
+	if !errors.Is(err, stop) {
+		t.Errorf("expected the yield error, got %v", err)
+	}
+	if count != 5 {
+		t.Errorf("expected reading to stop after event 5, got %v events", count)
+	}
+	//at most the 3 events holding a slot and one the producer had already committed to are read after event 5.
+	if reader.reads > 9 {
+		t.Errorf("expected no new reads once reading stopped, got %v reads", reader.reads)
+	}
+}
@@ -0,0 +1,396 @@
+package actions
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/USACE/go-consequences/consequences"
+	"github.com/USACE/go-consequences/geography"
+	gc "github.com/USACE/go-consequences/hazardproviders"
+	"github.com/USACE/go-consequences/hazards"
+	"github.com/USACE/go-consequences/structures"
+	lhp "github.com/usace-cloud-compute/consequences-runner/hazardproviders"
+)
+
+// frequencyStructureHeaders are the structure columns of the frequency computes, the aal and first wet probability are filled in after all frequencies are computed.
+var frequencyStructureHeaders = []string{"ORIG_ID", "REPVAL", "STORY", "FOUND_T", "FOUND_H", "x", "y", "OccType", "DamCat", "BASEFIN", "FFH", "DEMFT", "BAAL", "CAAL", "TAAL", "PROB"}
+
+// FrequencyHazardProvider provides the hazard events of one frequency at a location,
+// a single event for a deterministic grid or one event per sample for an uncertain grid. a nil event is a dry sample and has no damage.
+type FrequencyHazardProvider interface {
+	Hazards(l geography.Location) ([]hazards.HazardEvent, error)
+	HazardBoundary() (geography.BBox, error)
+}
+
+// deterministicFrequencyProvider adapts a go-consequences hazard provider to a single event per location.
+type deterministicFrequencyProvider struct {
+	gc.HazardProvider
+	boundary gc.HazardProvider //the primary grid the hazard boundary is read from, the hazard provider is used when nil
+}
+
+func (dp deterministicFrequencyProvider) HazardBoundary() (geography.BBox, error) {
+	if dp.boundary != nil {
+		return dp.boundary.HazardBoundary()
+	}
+	return dp.HazardProvider.HazardBoundary()
+}
+
+func (dp deterministicFrequencyProvider) Hazards(l geography.Location) ([]hazards.HazardEvent, error) {
+	e, err := dp.Hazard(l)
+	if err != nil {
+		return nil, err
+	}
+	return []hazards.HazardEvent{e}, nil
+}
+
+// FrequencyCompute computes the damage of every structure at each frequency and integrates the aal.
+// when Uncertain each frequency is summarized by the mean and standard deviation of its events, otherwise each frequency has a single event.
+type FrequencyCompute struct {
+	Frequencies          []float64 //most to least frequent, in the order of the hazard providers
+	EAD                  EADOptions
+	Output               frequencyOutput
+	Uncertain            bool
+	Percentiles          []float64 //percentiles of the aal of each sample, only reported when Uncertain
+	ConvergenceTolerance float64   //above zero reports convergence diagnostics, only when Uncertain
+}
+
+// frequencyDamages are the damages and hazards of the events of one frequency at one structure.
+type frequencyDamages struct {
+	structure []float64
+	content   []float64
+	wet       bool
+	events    []hazards.HazardEvent
+	computed  []bool
+}
+
+func computeFrequencyDamages(f consequences.Receptor, events []hazards.HazardEvent) (frequencyDamages, error) {
+	fd := frequencyDamages{events: events}
+	for _, e := range events {
+		sd, cd := 0.0, 0.0
+		if e == nil {
+			fd.structure = append(fd.structure, sd)
+			fd.content = append(fd.content, cd)
+			fd.computed = append(fd.computed, false)
+			continue
+		}
+		r, err := f.Compute(e)
+		if err == nil {
+			fd.wet = true
+			sdam, err := r.Fetch("structure damage")
+			if err != nil {
+				return fd, errors.New("could not fetch structure damage")
+			}
+			sd = sdam.(float64)
+			cdam, err := r.Fetch("content damage")
+			if err != nil {
+				return fd, errors.New("could not fetch content damage")
+			}
+			cd = cdam.(float64)
+		}
+		fd.structure = append(fd.structure, sd)
+		fd.content = append(fd.content, cd)
+		fd.computed = append(fd.computed, err == nil)
+	}
+	return fd, nil
+}
+
+// hazardStatistics returns the mean and standard deviation of each hazard parameter the events have, an event without damage contributes a dry hazard.
+func (fd frequencyDamages) hazardStatistics() (hazards.HazardEvent, hazards.HazardEvent) {
+	parameters := make([]hazards.Parameter, 0)
+	for _, p := range lhp.SampledParameters {
+		for _, e := range fd.events {
+			if e != nil && e.Has(p) {
+				parameters = append(parameters, p)
+				break
+			}
+		}
+	}
+	means := make([]float64, len(parameters))
+	stdevs := make([]float64, len(parameters))
+	for i, p := range parameters {
+		st := InitOnlineStatistics()
+		for j, e := range fd.events {
+			v := 0.0
+			if fd.computed[j] {
+				v = lhp.ParameterValue(e, p)
+			}
+			st.Add(v)
+		}
+		means[i] = st.Mean()
+		stdevs[i] = st.StandardDeviation()
+	}
+	return hazards.HazardDataToMultiParameter(lhp.InitHazardData(parameters, means)), hazards.HazardDataToMultiParameter(lhp.InitHazardData(parameters, stdevs))
+}
+
+func hazardJSON(e hazards.HazardEvent) (string, error) {
+	b, err := json.Marshal(e)
+	return string(b), err
+}
+
+// frequencyColumns sets the frequency and summary columns of the output.
+func (fc FrequencyCompute) frequencyColumns() frequencyOutput {
+	fo := fc.Output
+	fo.freqs = fc.Frequencies
+	fo.structureHeaders = frequencyStructureHeaders
+	fo.summaryHeaders = []string{}
+	if !fc.Uncertain {
+		fo.columns = []frequencyColumn{{"s_dmg", "S"}, {"c_dmg", "C"}, {"hazard", "H"}}
+		return fo
+	}
+	fo.columns = []frequencyColumn{{"s_dmg_mean", "MS"}, {"s_dmg_sd", "SS"}, {"c_dmg_mean", "MC"}, {"c_dmg_sd", "SC"}, {"haz_mean", "MH"}, {"haz_sd", "SH"}}
+	for _, prefix := range []string{"BAAL_", "CAAL_", "TAAL_"} {
+		for _, p := range fc.Percentiles {
+			fo.summaryHeaders = append(fo.summaryHeaders, prefix+percentileLabel(p))
+		}
+	}
+	if fc.ConvergenceTolerance > 0 {
+		fo.columns = append(fo.columns, frequencyColumn{"dmg_se", "SE"})
+		fo.summaryHeaders = append(fo.summaryHeaders, "NSAMP", "MAXRSE", "CONV")
+	}
+	return fo
+}
+
+// frequencyValues returns the values of the frequency columns.
+func (fc FrequencyCompute) frequencyValues(fd frequencyDamages) ([]interface{}, error) {
+	if !fc.Uncertain {
+		shaz, err := hazardJSON(fd.events[0])
+		return []interface{}{fd.structure[0], fd.content[0], shaz}, err
+	}
+	structure := InitOnlineStatistics()
+	content := InitOnlineStatistics()
+	for i := range fd.structure {
+		structure.Add(fd.structure[i])
+		content.Add(fd.content[i])
+	}
+	mean, stdev := fd.hazardStatistics()
+	shaz, err := hazardJSON(mean)
+	if err != nil {
+		return nil, err
+	}
+	stdevshaz, err := hazardJSON(stdev)
+	if err != nil {
+		return nil, err
+	}
+	return []interface{}{structure.Mean(), structure.StandardDeviation(), content.Mean(), content.StandardDeviation(), shaz, stdevshaz}, nil
+}
+
+// noHazardValues are the frequency columns of a frequency without a hazard at the structure.
+func (fc FrequencyCompute) noHazardValues() []interface{} {
+	if !fc.Uncertain {
+		return []interface{}{0.0, 0.0, "no hazard"}
+	}
+	return []interface{}{0.0, 0.0, 0.0, 0.0, "no-hazard", "no-hazard"}
+}
+
+// Compute writes the structures within the hazard boundary of the rarest frequency that are wet at any frequency.
+func (fc FrequencyCompute) Compute(hps []FrequencyHazardProvider, sp consequences.StreamProvider, w consequences.ResultsWriter) error {
+	fmt.Printf("Computing %v frequencies\n", len(fc.Frequencies))
+	if len(hps) != len(fc.Frequencies) {
+		return errors.New("hazard providers and frequencies have different lengths")
+	}
+	freqs := fc.Frequencies
+	//ASSUMPTION! get bounding box from largest frequency.
+	bbox, err := hps[len(hps)-1].HazardBoundary()
+	if err != nil {
+		return err
+	}
+	fo := fc.frequencyColumns()
+	header := fo.Headers()
+	err = validateHeaders(header)
+	if err != nil {
+		return err
+	}
+	var computeErr error
+	sp.ByBbox(bbox, func(f consequences.Receptor) {
+		s, sok := f.(structures.StructureDeterministic)
+		if !sok || computeErr != nil {
+			return
+		}
+		results := []interface{}{s.Name, s.StructVal, s.NumStories, s.FoundType, s.FoundHt, s.Location().X, s.Location().Y, s.OccType.Name, s.DamCat, "unkown", s.FoundHt + s.GroundElevation, s.GroundElevation, 0.0, 0.0, 0.0, 0.0}
+		frequencyValues := make([][]interface{}, len(freqs))
+		msEADs := make([]float64, len(freqs))
+		mcEADs := make([]float64, len(freqs))
+		totals := make([]*OnlineStatistics, len(freqs))
+		structureDamages := make([][]float64, len(freqs))
+		contentDamages := make([][]float64, len(freqs))
+		gotWet := false
+		firstProb := 0.0
+		for index, hp := range hps {
+			events, err := hp.Hazards(geography.Location{X: f.Location().X, Y: f.Location().Y})
+			if err != nil || len(events) == 0 {
+				frequencyValues[index] = fc.noHazardValues()
+				continue
+			}
+			fd, err := computeFrequencyDamages(f, events)
+			if err != nil {
+				computeErr = err
+				return
+			}
+			if fd.wet && !gotWet {
+				firstProb = freqs[index]
+				gotWet = true
+			}
+			frequencyValues[index], err = fc.frequencyValues(fd)
+			if err != nil {
+				computeErr = err
+				return
+			}
+			totals[index] = InitOnlineStatistics()
+			for i := range fd.structure {
+				msEADs[index] += fd.structure[i] / float64(len(fd.structure))
+				mcEADs[index] += fd.content[i] / float64(len(fd.content))
+				totals[index].Add(fd.structure[i] + fd.content[i])
+			}
+			structureDamages[index] = fd.structure
+			contentDamages[index] = fd.content
+		}
+		if !gotWet {
+			return
+		}
+		results[15] = firstProb
+		sEAD, err := fc.EAD.Integrate(msEADs, freqs)
+		if err != nil {
+			computeErr = err
+			return
+		}
+		cEAD, err := fc.EAD.Integrate(mcEADs, freqs)
+		if err != nil {
+			computeErr = err
+			return
+		}
+		results[12] = sEAD
+		results[13] = cEAD
+		results[14] = sEAD + cEAD
+		summary := make([]interface{}, 0, len(fo.summaryHeaders))
+		if fc.Uncertain {
+			dist, err := aalPercentiles(structureDamages, contentDamages, freqs, fc.EAD, fc.Percentiles)
+			if err != nil {
+				computeErr = err
+				return
+			}
+			for _, values := range [][]float64{dist.Structure, dist.Content, dist.Total} {
+				for _, v := range values {
+					summary = append(summary, v)
+				}
+			}
+			if fc.ConvergenceTolerance > 0 {
+				cd := convergenceDiagnostics(totals, fc.ConvergenceTolerance)
+				for i, se := range cd.StandardErrors {
+					frequencyValues[i] = append(frequencyValues[i], se)
+				}
+				converged := int32(0)
+				if cd.Converged {
+					converged = 1
+				}
+				summary = append(summary, int32(cd.Samples), cd.MaxRelativeSE, converged)
+			}
+		}
+		fo.Write(w, header, results, frequencyValues, summary)
+	})
+	return computeErr
+}
+
+func parsePercentiles(s string) ([]float64, error) {
+	parts := strings.Split(s, ",")
+	percentiles := make([]float64, 0, len(parts))
+	for _, p := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return nil, err
+		}
+		if v < 0 || v > 1 {
+			return nil, errors.New("percentiles must be between 0 and 1, got " + p)
+		}
+		percentiles = append(percentiles, v)
+	}
+	return percentiles, nil
+}
+
+// percentileLabel names a percentile for a field name, 0.05 is P5 and 0.025 is P2_5.
+func percentileLabel(p float64) string {
+	return "P" + strings.ReplaceAll(strconv.FormatFloat(p*100, 'f', -1, 64), ".", "_")
+}
+
+// AALDistribution are percentiles of the aal of each sample, found by integrating the sample's damages across the frequencies.
+type AALDistribution struct {
+	Structure []float64
+	Content   []float64
+	Total     []float64
+}
+
+// aalPercentiles integrates the damage-frequency curve of each sample, sample k at every frequency, and returns percentiles of the resulting aal.
+// a frequency without a hazard is nil and contributes no damage.
+func aalPercentiles(structureDamages [][]float64, contentDamages [][]float64, freqs []float64, ead EADOptions, percentiles []float64) (AALDistribution, error) {
+	samples := 0
+	for _, d := range structureDamages {
+		if len(d) > samples {
+			samples = len(d)
+		}
+	}
+	saals := make([]float64, samples)
+	caals := make([]float64, samples)
+	taals := make([]float64, samples)
+	ms := make([]float64, len(freqs))
+	mc := make([]float64, len(freqs))
+	for k := 0; k < samples; k++ {
+		for i := range freqs {
+			ms[i], mc[i] = 0, 0
+			if k < len(structureDamages[i]) {
+				ms[i] = structureDamages[i][k]
+				mc[i] = contentDamages[i][k]
+			}
+		}
+		var err error
+		saals[k], err = ead.Integrate(ms, freqs)
+		if err != nil {
+			return AALDistribution{}, err
+		}
+		caals[k], err = ead.Integrate(mc, freqs)
+		if err != nil {
+			return AALDistribution{}, err
+		}
+		taals[k] = saals[k] + caals[k]
+	}
+	sort.Float64s(saals)
+	sort.Float64s(caals)
+	sort.Float64s(taals)
+	dist := AALDistribution{}
+	for _, p := range percentiles {
+		dist.Structure = append(dist.Structure, percentile(saals, p))
+		dist.Content = append(dist.Content, percentile(caals, p))
+		dist.Total = append(dist.Total, percentile(taals, p))
+	}
+	return dist, nil
+}
+
+// ConvergenceDiagnostics describe how well the sampled mean total damage of a structure is estimated at each frequency.
+type ConvergenceDiagnostics struct {
+	StandardErrors []float64 //standard error of the mean total damage at each frequency
+	Samples        int
+	MaxRelativeSE  float64 //largest standard error relative to its mean across the frequencies with damage
+	Converged      bool
+}
+
+// convergenceDiagnostics summarizes the total damage statistics of each frequency, a frequency without a hazard is nil.
+func convergenceDiagnostics(totals []*OnlineStatistics, tolerance float64) ConvergenceDiagnostics {
+	cd := ConvergenceDiagnostics{StandardErrors: make([]float64, len(totals))}
+	for i, st := range totals {
+		if st == nil {
+			continue
+		}
+		cd.StandardErrors[i] = st.StandardError()
+		if st.Count() > cd.Samples {
+			cd.Samples = st.Count()
+		}
+		if st.Mean() > 0 {
+			cd.MaxRelativeSE = math.Max(cd.MaxRelativeSE, cd.StandardErrors[i]/st.Mean())
+		}
+	}
+	cd.Converged = cd.MaxRelativeSE <= tolerance
+	return cd
+}
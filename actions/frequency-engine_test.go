@@ -0,0 +1,195 @@
+package actions
+
+import (
+	"math"
+	"testing"
+
+	"github.com/HydrologicEngineeringCenter/go-statistics/paireddata"
+	"github.com/USACE/go-consequences/consequences"
+	"github.com/USACE/go-consequences/geography"
+	gc "github.com/USACE/go-consequences/hazardproviders"
+	"github.com/USACE/go-consequences/hazards"
+	"github.com/USACE/go-consequences/structures"
+)
+
+// fixedFrequencyProvider returns a depth event per depth, a negative depth is a dry sample.
+type fixedFrequencyProvider struct {
+	depths []float64
+}
+
+func (fp fixedFrequencyProvider) Hazards(l geography.Location) ([]hazards.HazardEvent, error) {
+	if len(fp.depths) == 0 {
+		return nil, gc.NoHazardFoundError{}
+	}
+	events := make([]hazards.HazardEvent, len(fp.depths))
+	for i, d := range fp.depths {
+		if d < 0 {
+			continue
+		}
+		e := hazards.DepthEvent{}
+		e.SetDepth(d)
+		events[i] = e
+	}
+	return events, nil
+}
+func (fp fixedFrequencyProvider) HazardBoundary() (geography.BBox, error) {
+	return geography.BBox{Bbox: []float64{0, 1, 1, 0}}, nil
+}
+
+type sliceStreamProvider struct {
+	receptors []consequences.Receptor
+}
+
+func (sp sliceStreamProvider) ByFips(fipscode string, p consequences.StreamProcessor) {
+	sp.ByBbox(geography.BBox{}, p)
+}
+func (sp sliceStreamProvider) ByBbox(bbox geography.BBox, p consequences.StreamProcessor) {
+	for _, r := range sp.receptors {
+		p(r)
+	}
+}
+
+type memoryResultsWriter struct {
+	results *[]consequences.Result
+}
+
+func (w memoryResultsWriter) Write(r consequences.Result) {
+	*w.results = append(*w.results, r)
+}
+func (w memoryResultsWriter) Close() {}
+
+func testStructure() structures.StructureDeterministic {
+	df := structures.DamageFunction{Source: "fabricated", DamageDriver: hazards.Depth, DamageFunction: paireddata.PairedData{Xvals: []float64{0, 4}, Yvals: []float64{0, 40}}}
+	family := structures.DamageFunctionFamily{DamageFunctions: map[hazards.Parameter]structures.DamageFunction{hazards.Default: df}}
+	o := structures.OccupancyTypeDeterministic{Name: "test", ComponentDamageFunctions: map[string]structures.DamageFunctionFamily{"structure": family, "contents": family}}
+	return structures.StructureDeterministic{OccType: o, StructVal: 100, ContVal: 50, BaseStructure: structures.BaseStructure{Name: "1", DamCat: "RES"}}
+}
+
+func Test_FrequencyComputeDeterministic(t *testing.T) {
+	freqs := []float64{0.1, 0.01}
+	ead := EADOptions{Method: TrapezoidEAD, Tail: ConstantTail}
+	fc := FrequencyCompute{Frequencies: freqs, EAD: ead, Output: frequencyOutput{format: WideFrequencyOutput, naming: LegacyColumnNaming}}
+	results := make([]consequences.Result, 0)
+	sp := sliceStreamProvider{receptors: []consequences.Receptor{testStructure()}}
+	hps := []FrequencyHazardProvider{fixedFrequencyProvider{}, fixedFrequencyProvider{depths: []float64{2}}}
+	err := fc.Compute(hps, sp, memoryResultsWriter{&results})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("expected one row, got %v", len(results))
+	}
+	r := results[0]
+	if len(r.Headers) != len(r.Result) {
+		t.Fatalf("%v headers and %v values", len(r.Headers), len(r.Result))
+	}
+	want, _ := ead.Integrate([]float64{0, 20}, freqs)
+	if baal := r.Result[12].(float64); math.Abs(baal-want) > 1e-9 {
+		t.Errorf("expected a baal of %v, got %v", want, baal)
+	}
+	if prob := r.Result[15].(float64); prob != 0.01 {
+		t.Errorf("expected the first wet probability to be 0.01, got %v", prob)
+	}
+	if h := r.Result[len(frequencyStructureHeaders)+2]; h != "no hazard" {
+		t.Errorf("expected the dry frequency to have no hazard, got %v", h)
+	}
+}
+
+func Test_FrequencyComputeUncertainLong(t *testing.T) {
+	freqs := []float64{0.1, 0.01}
+	fc := FrequencyCompute{Frequencies: freqs, EAD: EADOptions{Method: SpecialEAD, Tail: ConstantTail}, Output: frequencyOutput{format: LongFrequencyOutput, naming: LegacyColumnNaming}, Uncertain: true, Percentiles: []float64{0.5}, ConvergenceTolerance: 0.05}
+	results := make([]consequences.Result, 0)
+	sp := sliceStreamProvider{receptors: []consequences.Receptor{testStructure()}}
+	hps := []FrequencyHazardProvider{fixedFrequencyProvider{depths: []float64{0, 1}}, fixedFrequencyProvider{depths: []float64{1, 3}}}
+	err := fc.Compute(hps, sp, memoryResultsWriter{&results})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != len(freqs) {
+		t.Fatalf("expected a row per frequency, got %v", len(results))
+	}
+	for _, r := range results {
+		if len(r.Headers) != len(r.Result) {
+			t.Fatalf("%v headers and %v values", len(r.Headers), len(r.Result))
+		}
+	}
+}
+
+func Test_FrequencyComputeProviderCount(t *testing.T) {
+	fc := FrequencyCompute{Frequencies: []float64{0.1, 0.01}}
+	err := fc.Compute([]FrequencyHazardProvider{fixedFrequencyProvider{}}, sliceStreamProvider{}, memoryResultsWriter{})
+	if err == nil {
+		t.Fatal("expected an error for a missing hazard provider")
+	}
+}
+
+func Test_FrequencyComputeHeadersFitSpatialFields(t *testing.T) {
+	freqs := []float64{0.5, 0.4, 0.1, 0.04, 0.02, 0.01, 0.005, 0.002, 0.001, 0.0002}
+	for _, format := range []FrequencyOutputFormat{WideFrequencyOutput, LongFrequencyOutput} {
+		for _, naming := range []FrequencyColumnNaming{LegacyColumnNaming, ReturnPeriodColumnNaming} {
+			for _, uncertain := range []bool{false, true} {
+				fc := FrequencyCompute{Frequencies: freqs, Output: frequencyOutput{format: format, naming: naming}, Uncertain: uncertain, Percentiles: []float64{0.025, 0.5, 0.975}, ConvergenceTolerance: 0.05}
+				headers := fc.frequencyColumns().Headers()
+				err := validateHeaders(headers)
+				if err != nil {
+					t.Errorf("%v %v uncertain=%v: %v", format, naming, uncertain, err)
+				}
+			}
+		}
+	}
+	fc := FrequencyCompute{Frequencies: []float64{0.01, 0.00999}, Output: frequencyOutput{format: WideFrequencyOutput, naming: ReturnPeriodColumnNaming}}
+	if validateHeaders(fc.frequencyColumns().Headers()) == nil {
+		t.Error("expected an error when two frequencies round to the same return period")
+	}
+}
+
+func Test_FrequencyComputeKeepsDrySamples(t *testing.T) {
+	freqs := []float64{0.1, 0.01}
+	fc := FrequencyCompute{Frequencies: freqs, EAD: EADOptions{Method: TrapezoidEAD, Tail: ConstantTail}, Output: frequencyOutput{format: WideFrequencyOutput, naming: LegacyColumnNaming}, Uncertain: true}
+	results := make([]consequences.Result, 0)
+	sp := sliceStreamProvider{receptors: []consequences.Receptor{testStructure()}}
+	hps := []FrequencyHazardProvider{fixedFrequencyProvider{depths: []float64{-1, 2}}, fixedFrequencyProvider{depths: []float64{2, 2}}}
+	err := fc.Compute(hps, sp, memoryResultsWriter{&results})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("expected one row, got %v", len(results))
+	}
+	//the dry sample halves the mean structure damage of the frequent event instead of dropping the frequency.
+	mean := results[0].Result[len(frequencyStructureHeaders)]
+	if mean != 10.0 {
+		t.Errorf("expected a mean structure damage of 10, got %v", mean)
+	}
+	if prob := results[0].Result[15].(float64); prob != 0.1 {
+		t.Errorf("expected the first wet probability to be 0.1, got %v", prob)
+	}
+}
+
+// boxHazardProvider is a go-consequences hazard provider with a fixed boundary.
+type boxHazardProvider struct {
+	bbox []float64
+}
+
+func (bp boxHazardProvider) Hazard(l geography.Location) (hazards.HazardEvent, error) {
+	e := hazards.DepthEvent{}
+	e.SetDepth(1)
+	return e, nil
+}
+func (bp boxHazardProvider) HazardBoundary() (geography.BBox, error) {
+	return geography.BBox{Bbox: bp.bbox}, nil
+}
+func (bp boxHazardProvider) Close() {}
+
+func Test_DeterministicFrequencyProviderBoundary(t *testing.T) {
+	multi := boxHazardProvider{bbox: []float64{0, 1, 1, 0}}
+	depth := boxHazardProvider{bbox: []float64{0, 2, 2, 0}}
+	bbox, err := deterministicFrequencyProvider{HazardProvider: multi, boundary: depth}.HazardBoundary()
+	if err != nil || bbox.Bbox[1] != 2 {
+		t.Errorf("expected the boundary of the depth grid, got %v", bbox)
+	}
+	bbox, err = deterministicFrequencyProvider{HazardProvider: multi}.HazardBoundary()
+	if err != nil || bbox.Bbox[1] != 1 {
+		t.Errorf("expected the boundary of the hazard provider without a primary grid, got %v", bbox)
+	}
+}
@@ -0,0 +1,147 @@
+package actions
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/USACE/go-consequences/consequences"
+	"github.com/usace-cloud-compute/cc-go-sdk"
+)
+
+const (
+	frequencyOutputFormatKey string = "frequencyOutputFormat" //optional, wide or long. defaults to wide.
+	frequencyColumnNamingKey string = "frequencyColumnNaming" //optional, legacy or return-period. defaults to legacy.
+)
+
+// FrequencyOutputFormat chooses between one row per structure and one row per structure and frequency.
+type FrequencyOutputFormat string
+
+const (
+	WideFrequencyOutput FrequencyOutputFormat = "wide" //one row per structure with a group of columns per frequency
+	LongFrequencyOutput FrequencyOutputFormat = "long" //one row per structure and frequency with frequency and ret_period columns
+)
+
+// FrequencyColumnNaming chooses how the wide format names the columns of each frequency.
+type FrequencyColumnNaming string
+
+const (
+	LegacyColumnNaming       FrequencyColumnNaming = "legacy"        //the frequency followed by a suffix, e.g. 0.010000S
+	ReturnPeriodColumnNaming FrequencyColumnNaming = "return-period" //the suffix followed by the return period, e.g. S100 or MS2_5
+)
+
+// maxFieldNameLength is the longest field name the spatial results writers keep, longer names are truncated.
+const maxFieldNameLength int = 10
+
+// frequencyColumn is a value reported for every frequency.
+type frequencyColumn struct {
+	name         string //used by the long format
+	legacySuffix string //used by the wide format
+}
+
+// frequencyOutput lays out the results of the frequency computes, structure columns come first, then the frequency columns, then the summary columns.
+type frequencyOutput struct {
+	format           FrequencyOutputFormat
+	naming           FrequencyColumnNaming
+	freqs            []float64
+	structureHeaders []string
+	columns          []frequencyColumn
+	summaryHeaders   []string
+}
+
+// initFrequencyOutput reads the output format and naming attributes.
+func initFrequencyOutput(attributes cc.PayloadAttributes, freqs []float64) (frequencyOutput, error) {
+	fo := frequencyOutput{freqs: freqs}
+	format := FrequencyOutputFormat(attributes.GetStringOrDefault(frequencyOutputFormatKey, string(WideFrequencyOutput)))
+	switch format {
+	case WideFrequencyOutput, LongFrequencyOutput:
+		fo.format = format
+	default:
+		return fo, errors.New("unknown frequency output format " + string(format) + ", expected wide or long")
+	}
+	naming := FrequencyColumnNaming(attributes.GetStringOrDefault(frequencyColumnNamingKey, string(LegacyColumnNaming)))
+	switch naming {
+	case LegacyColumnNaming, ReturnPeriodColumnNaming:
+		fo.naming = naming
+	default:
+		return fo, errors.New("unknown frequency column naming " + string(naming) + ", expected legacy or return-period")
+	}
+	return fo, nil
+}
+
+// frequencyColumnName names a frequency column in the wide format.
+func (fo frequencyOutput) frequencyColumnName(c frequencyColumn, f float64) string {
+	if fo.naming == ReturnPeriodColumnNaming {
+		return c.legacySuffix + strings.ReplaceAll(strconv.FormatFloat(roundReturnPeriod(1/f), 'f', -1, 64), ".", "_")
+	}
+	return fmt.Sprintf("%1.6f%s", f, c.legacySuffix)
+}
+
+// roundReturnPeriod keeps a return period short enough for a field name, whole years from 10 years and tenths below.
+func roundReturnPeriod(rp float64) float64 {
+	if rp >= 10 {
+		return math.Round(rp)
+	}
+	return math.Round(rp*10) / 10
+}
+
+// validateHeaders checks the headers are unique and short enough to survive the spatial results writers.
+func validateHeaders(headers []string) error {
+	seen := make(map[string]bool, len(headers))
+	for _, h := range headers {
+		if len(h) > maxFieldNameLength {
+			return fmt.Errorf("the field name %v is longer than %v characters", h, maxFieldNameLength)
+		}
+		if seen[h] {
+			return fmt.Errorf("the field name %v is repeated, check the frequencies are not too close together", h)
+		}
+		seen[h] = true
+	}
+	return nil
+}
+
+func (fo frequencyOutput) Headers() []string {
+	header := append([]string{}, fo.structureHeaders...)
+	if fo.format == LongFrequencyOutput {
+		header = append(header, fo.summaryHeaders...)
+		header = append(header, "frequency", "ret_period")
+		for _, c := range fo.columns {
+			header = append(header, c.name)
+		}
+		return header
+	}
+	for _, f := range fo.freqs {
+		for _, c := range fo.columns {
+			header = append(header, fo.frequencyColumnName(c, f))
+		}
+	}
+	return append(header, fo.summaryHeaders...)
+}
+
+// Rows returns the rows of one structure, frequencyValues holds the values of the frequency columns for each frequency.
+func (fo frequencyOutput) Rows(structureValues []interface{}, frequencyValues [][]interface{}, summaryValues []interface{}) [][]interface{} {
+	if fo.format == LongFrequencyOutput {
+		rows := make([][]interface{}, len(fo.freqs))
+		for i, f := range fo.freqs {
+			row := append([]interface{}{}, structureValues...)
+			row = append(row, summaryValues...)
+			row = append(row, f, 1/f)
+			rows[i] = append(row, frequencyValues[i]...)
+		}
+		return rows
+	}
+	row := append([]interface{}{}, structureValues...)
+	for _, values := range frequencyValues {
+		row = append(row, values...)
+	}
+	return [][]interface{}{append(row, summaryValues...)}
+}
+
+// Write writes the rows of one structure.
+func (fo frequencyOutput) Write(w consequences.ResultsWriter, headers []string, structureValues []interface{}, frequencyValues [][]interface{}, summaryValues []interface{}) {
+	for _, row := range fo.Rows(structureValues, frequencyValues, summaryValues) {
+		w.Write(consequences.Result{Headers: headers, Result: row})
+	}
+}
@@ -0,0 +1,52 @@
+package actions
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/usace-cloud-compute/cc-go-sdk"
+)
+
+func testFrequencyOutput(t *testing.T, attributes cc.PayloadAttributes) frequencyOutput {
+	fo, err := initFrequencyOutput(attributes, []float64{0.1, 0.01})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fo.structureHeaders = []string{"ORIG_ID", "TAAL"}
+	fo.columns = []frequencyColumn{{"s_dmg", "S"}, {"c_dmg", "C"}}
+	fo.summaryHeaders = []string{"TAAL_P50"}
+	return fo
+}
+
+func Test_FrequencyOutputWide(t *testing.T) {
+	fo := testFrequencyOutput(t, cc.PayloadAttributes{})
+	expected := []string{"ORIG_ID", "TAAL", "0.100000S", "0.100000C", "0.010000S", "0.010000C", "TAAL_P50"}
+	if !reflect.DeepEqual(fo.Headers(), expected) {
+		t.Errorf("expected legacy headers %v, got %v", expected, fo.Headers())
+	}
+	fo = testFrequencyOutput(t, cc.PayloadAttributes{frequencyColumnNamingKey: "return-period"})
+	expected = []string{"ORIG_ID", "TAAL", "S10", "C10", "S100", "C100", "TAAL_P50"}
+	if !reflect.DeepEqual(fo.Headers(), expected) {
+		t.Errorf("expected return period headers %v, got %v", expected, fo.Headers())
+	}
+	rows := fo.Rows([]interface{}{"a", 5.0}, [][]interface{}{{1.0, 2.0}, {3.0, 4.0}}, []interface{}{4.5})
+	if len(rows) != 1 || !reflect.DeepEqual(rows[0], []interface{}{"a", 5.0, 1.0, 2.0, 3.0, 4.0, 4.5}) {
+		t.Errorf("unexpected wide rows %v", rows)
+	}
+}
+
+func Test_FrequencyOutputLong(t *testing.T) {
+	fo := testFrequencyOutput(t, cc.PayloadAttributes{frequencyOutputFormatKey: "long"})
+	expected := []string{"ORIG_ID", "TAAL", "TAAL_P50", "frequency", "ret_period", "s_dmg", "c_dmg"}
+	if !reflect.DeepEqual(fo.Headers(), expected) {
+		t.Errorf("expected long headers %v, got %v", expected, fo.Headers())
+	}
+	rows := fo.Rows([]interface{}{"a", 5.0}, [][]interface{}{{1.0, 2.0}, {3.0, 4.0}}, []interface{}{4.5})
+	if len(rows) != 2 || !reflect.DeepEqual(rows[1], []interface{}{"a", 5.0, 4.5, 0.01, 100.0, 3.0, 4.0}) {
+		t.Errorf("unexpected long rows %v", rows)
+	}
+	_, err := initFrequencyOutput(cc.PayloadAttributes{frequencyOutputFormatKey: "tall"}, []float64{0.1})
+	if err == nil {
+		t.Error("expected an error for an unknown output format")
+	}
+}
@@ -0,0 +1,345 @@
+package actions
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/USACE/go-consequences/consequences"
+	"github.com/USACE/go-consequences/resultswriters"
+	"github.com/dewberry/gdal"
+	"github.com/usace-cloud-compute/cc-go-sdk"
+)
+
+const (
+	depthThresholdsKey                  string  = "depthThresholds" //optional, comma separated depths in feet above the first floor. defaults to 0, 1, 2.
+	defaultDepthThresholds              string  = "0, 1, 2"
+	summarizeHazardExceedanceActionName string  = "summarize-hazard-exceedance"
+	hazardClassCount                    int     = 6
+	feetToMeters                        float64 = 0.3048
+)
+
+func init() {
+	cc.ActionRegistry.RegisterAction(summarizeHazardExceedanceActionName, &SummarizeHazardExceedanceAction{})
+}
+
+// SummarizeHazardExceedanceAction computes the annual exceedance probability of depth thresholds above the first floor and depth-velocity hazard classes at each structure.
+// the first floor is the foundation height of the structure in the inventory above the ground.
+type SummarizeHazardExceedanceAction struct {
+	cc.ActionRunnerBase
+}
+
+// hazardClassLimits are the upper limits of the depth-velocity hazard classes H1 to H5 in meters and meters per second, anything beyond H5 is H6.
+var hazardClassLimits = []struct {
+	depth         float64
+	velocity      float64
+	depthVelocity float64
+}{
+	{0.3, 2.0, 0.3},
+	{0.5, 2.0, 0.6},
+	{1.2, 2.0, 0.6},
+	{2.0, 2.0, 1.0},
+	{4.0, 4.0, 4.0},
+}
+
+// hazardClass returns the depth-velocity hazard class (1 to 6) of a depth in feet and a velocity in feet per second, a dry structure is class 0.
+func hazardClass(depth float64, velocity float64) int {
+	if depth <= 0 {
+		return 0
+	}
+	d := depth * feetToMeters
+	v := math.Abs(velocity) * feetToMeters
+	for i, l := range hazardClassLimits {
+		if d <= l.depth && v <= l.velocity && d*v <= l.depthVelocity {
+			return i + 1
+		}
+	}
+	return hazardClassCount
+}
+
+// parseDepthThresholds parses a comma separated list of depth thresholds in feet above the first floor, thresholds are returned smallest to largest.
+func parseDepthThresholds(s string) ([]float64, error) {
+	parts := strings.Split(s, ",")
+	thresholds := make([]float64, 0, len(parts))
+	for _, p := range parts {
+		t, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return nil, err
+		}
+		thresholds = append(thresholds, t)
+	}
+	sort.Float64s(thresholds)
+	return thresholds, nil
+}
+
+// depthThresholdLabel is the column label of a depth threshold, short enough for shapefile field names.
+func depthThresholdLabel(t float64) string {
+	return "AEP_D" + strconv.FormatFloat(t, 'f', -1, 64)
+}
+
+// HazardExceedance is the exceedance summary of a single structure.
+type HazardExceedance struct {
+	Fdid           string
+	X              float64
+	Y              float64
+	DamageCategory string
+	OccupancyType  string
+	MaxDepth       float64 //above the ground
+	MaxVelocity    float64
+	DepthAEP       []float64 //the probability of exceeding each depth threshold above the first floor
+	ClassAEP       []float64 //the probability of reaching at least each hazard class, H1 first
+}
+
+// structureExposure counts the blocks in which a structure exceeded each threshold.
+type structureExposure struct {
+	fdid           string
+	x              float64
+	y              float64
+	damageCategory string
+	occupancyType  string
+	maxDepth       float64
+	maxVelocity    float64
+	block          int32
+	blockDepth     float64 //above the first floor
+	blockClass     int
+	depthCounts    []int
+	classCounts    []int
+}
+
+// commit adds the maxima of the current block to the counts.
+func (se *structureExposure) commit(thresholds []float64) {
+	for i, t := range thresholds {
+		if se.blockDepth > t {
+			se.depthCounts[i]++
+		}
+	}
+	for c := 1; c <= se.blockClass; c++ {
+		se.classCounts[c-1]++
+	}
+	se.blockDepth = math.Inf(-1)
+	se.blockClass = 0
+}
+
+// hazardExceedanceAccumulator tracks each structure's largest depth above the first floor and hazard class per block, events must arrive in block order.
+// hazard classes use the depth above the ground.
+type hazardExceedanceAccumulator struct {
+	thresholds        []float64
+	foundationHeights map[string]float64
+	structures        map[string]*structureExposure
+}
+
+// initHazardExceedanceAccumulator creates an accumulator, a structure without a foundation height has its first floor at the ground.
+func initHazardExceedanceAccumulator(thresholds []float64, foundationHeights map[string]float64) *hazardExceedanceAccumulator {
+	return &hazardExceedanceAccumulator{thresholds: thresholds, foundationHeights: foundationHeights, structures: make(map[string]*structureExposure)}
+}
+
+// readFoundationHeights reads the foundation height in feet of every structure in an inventory by fd_id.
+func readFoundationHeights(path string, driver string, tablename string) (map[string]float64, error) {
+	ds, ok := gdal.OGRDriverByName(driver).Open(path, int(gdal.ReadOnly))
+	if !ok {
+		return nil, errors.New("error opening inventory " + path)
+	}
+	defer ds.Destroy()
+	l := ds.LayerByName(tablename)
+	def := l.Definition()
+	fdidIdx := def.FieldIndex("fd_id")
+	foundationIdx := def.FieldIndex("found_ht")
+	if fdidIdx < 0 || foundationIdx < 0 {
+		return nil, errors.New("inventory " + path + " requires fd_id and found_ht")
+	}
+	heights := make(map[string]float64)
+	for f := l.NextFeature(); f != nil; f = l.NextFeature() {
+		heights[f.FieldAsString(fdidIdx)] = f.FieldAsFloat64(foundationIdx)
+		f.Destroy()
+	}
+	return heights, nil
+}
+
+func (ha *hazardExceedanceAccumulator) add(r ConsequenceResult) {
+	se, ok := ha.structures[r.Fdid]
+	if !ok {
+		se = &structureExposure{
+			fdid:           r.Fdid,
+			x:              r.X,
+			y:              r.Y,
+			damageCategory: r.DamageCategory,
+			occupancyType:  r.OccupancyType,
+			block:          r.BlockNumber,
+			blockDepth:     math.Inf(-1),
+			depthCounts:    make([]int, len(ha.thresholds)),
+			classCounts:    make([]int, hazardClassCount),
+		}
+		ha.structures[r.Fdid] = se
+	} else if se.block != r.BlockNumber {
+		se.commit(ha.thresholds)
+		se.block = r.BlockNumber
+	}
+	se.maxDepth = math.Max(se.maxDepth, r.Depth)
+	se.maxVelocity = math.Max(se.maxVelocity, r.Velocity)
+	se.blockDepth = math.Max(se.blockDepth, r.Depth-ha.foundationHeights[r.Fdid])
+	c := hazardClass(r.Depth, r.Velocity)
+	if c > se.blockClass {
+		se.blockClass = c
+	}
+}
+
+// results commits the last block of every structure and returns the exceedance probabilities out of blockCount blocks in fd_id order.
+func (ha *hazardExceedanceAccumulator) results(blockCount int) []HazardExceedance {
+	fdids := make([]string, 0, len(ha.structures))
+	for fdid := range ha.structures {
+		fdids = append(fdids, fdid)
+	}
+	sort.Strings(fdids)
+	results := make([]HazardExceedance, len(fdids))
+	for i, fdid := range fdids {
+		se := ha.structures[fdid]
+		se.commit(ha.thresholds)
+		r := HazardExceedance{
+			Fdid:           se.fdid,
+			X:              se.x,
+			Y:              se.y,
+			DamageCategory: se.damageCategory,
+			OccupancyType:  se.occupancyType,
+			MaxDepth:       se.maxDepth,
+			MaxVelocity:    se.maxVelocity,
+			DepthAEP:       make([]float64, len(se.depthCounts)),
+			ClassAEP:       make([]float64, len(se.classCounts)),
+		}
+		if blockCount > 0 {
+			for j, c := range se.depthCounts {
+				r.DepthAEP[j] = float64(c) / float64(blockCount)
+			}
+			for j, c := range se.classCounts {
+				r.ClassAEP[j] = float64(c) / float64(blockCount)
+			}
+		}
+		results[i] = r
+	}
+	return results
+}
+
+// accumulateHazardExceedance reads every event of the realization into a hazardExceedanceAccumulator.
+// it returns the number of blocks in the realization and the spatial reference of the event outputs.
+func accumulateHazardExceedance(blocks Blocks, realizationNumber int, resultPathPattern string, maxOpen int, read eventReaderFunc, report *ManifestReport, accumulator *hazardExceedanceAccumulator) (int, string, error) {
+	blockCount := 0
+	for _, b := range blocks {
+		if b.RealizationIndex == realizationNumber {
+			blockCount++
+		}
+	}
+	wkt := ""
+	err := readRealizationEvents(blocks, realizationNumber, resultPathPattern, maxOpen, read, report, func(e EventResults) error {
+		if wkt == "" {
+			wkt = e.Wkt
+		}
+		for _, r := range e.Results {
+			accumulator.add(r)
+		}
+		return nil
+	})
+	return blockCount, wkt, err
+}
+
+// hazardExceedanceHeaders returns the column names shared by the csv and spatial outputs.
+func hazardExceedanceHeaders(thresholds []float64) []string {
+	headers := []string{"fd_id", "x", "y", "damcat", "occtype", "MaxDepth", "MaxVel"}
+	for _, t := range thresholds {
+		headers = append(headers, depthThresholdLabel(t))
+	}
+	for c := 1; c <= hazardClassCount; c++ {
+		headers = append(headers, fmt.Sprintf("AEP_H%v", c))
+	}
+	return headers
+}
+
+func writeHazardExceedanceCsv(output io.Writer, thresholds []float64, results []HazardExceedance) error {
+	w := bufio.NewWriter(output)
+	w.WriteString(strings.Join(hazardExceedanceHeaders(thresholds), ",") + "\n")
+	for _, r := range results {
+		w.WriteString(fmt.Sprintf("%v,%v,%v,%v,%v,%.5f,%.5f", r.Fdid, r.X, r.Y, r.DamageCategory, r.OccupancyType, r.MaxDepth, r.MaxVelocity))
+		for _, p := range r.DepthAEP {
+			w.WriteString(fmt.Sprintf(",%.5f", p))
+		}
+		for _, p := range r.ClassAEP {
+			w.WriteString(fmt.Sprintf(",%.5f", p))
+		}
+		w.WriteString("\n")
+	}
+	return w.Flush()
+}
+
+func (ar *SummarizeHazardExceedanceAction) Run() error {
+	a := ar.Action
+	// get all relevant parameters
+	blockFilePath := a.Attributes.GetStringOrFail(blockFilePathKey)
+	realizationNumber := a.Attributes.GetIntOrFail(realizationNumberKey)
+	resultPathPattern := a.Attributes.GetStringOrFail(resultPathPatternKey)
+	tablename := a.Attributes.GetStringOrFail(tablenameKey)
+	driver := a.Attributes.GetStringOrFail(outputDriverKey)
+	realizationResultFilePath := a.Attributes.GetStringOrFail(realizationResultFilePathKey)
+	realizationSpatialResultFilePath := a.Attributes.GetStringOrFail(realizationSpatialResultsFilePathKey)
+	outTableName := a.Attributes.GetStringOrFail(outputTableNameKey)
+	outDriver := a.Attributes.GetStringOrFail(spatialOutputDriverKey)
+	maxOpenDatasets := a.Attributes.GetIntOrDefault(maxOpenDatasetsKey, defaultMaxOpenDatasets)
+	inventoryPath := a.Attributes.GetStringOrFail(inventoryPathKey)
+	inventoryDriver := a.Attributes.GetStringOrFail(inventoryDriverKey)
+	inventoryTableName := a.Attributes.GetStringOrDefault(inventoryTableNameKey, "nsi")
+	thresholds, err := parseDepthThresholds(a.Attributes.GetStringOrDefault(depthThresholdsKey, defaultDepthThresholds))
+	if err != nil {
+		return err
+	}
+	if len(thresholds) == 0 {
+		return errors.New("at least one depth threshold is required")
+	}
+	blocks, report, reportPath, err := readValidatedBlocks(a.Attributes, blockFilePath, realizationNumber, realizationResultFilePath)
+	if err != nil {
+		return err
+	}
+	foundationHeights, err := readFoundationHeights(inventoryPath, inventoryDriver, inventoryTableName)
+	if err != nil {
+		return err
+	}
+	accumulator := initHazardExceedanceAccumulator(thresholds, foundationHeights)
+	blockCount, wkt, err := accumulateHazardExceedance(blocks, realizationNumber, resultPathPattern, maxOpenDatasets, gdalEventReader(driver, tablename), report, accumulator)
+	if err != nil {
+		report.Write(reportPath)
+		return err
+	}
+	results := accumulator.results(blockCount)
+	resultwriter, err := os.Create(realizationResultFilePath)
+	if err != nil {
+		return err
+	}
+	defer resultwriter.Close()
+	err = writeHazardExceedanceCsv(resultwriter, thresholds, results)
+	if err != nil {
+		return err
+	}
+	rw, err := resultswriters.InitSpatialResultsWriter_WKT_Projected(realizationSpatialResultFilePath, outTableName, outDriver, wkt)
+	if err != nil {
+		return err
+	}
+	defer rw.Close()
+	headers := hazardExceedanceHeaders(thresholds)
+	for _, r := range results {
+		result := []interface{}{r.Fdid, r.X, r.Y, r.DamageCategory, r.OccupancyType, r.MaxDepth, r.MaxVelocity}
+		for _, p := range r.DepthAEP {
+			result = append(result, p)
+		}
+		for _, p := range r.ClassAEP {
+			result = append(result, p)
+		}
+		rw.Write(consequences.Result{Headers: headers, Result: result})
+	}
+	if len(report.MissingEvents) > 0 {
+		log.Printf("realization %v is missing %v of %v events, see %v\n", realizationNumber, len(report.MissingEvents), report.EventCount, reportPath)
+	}
+	return report.Write(reportPath)
+}
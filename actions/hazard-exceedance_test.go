@@ -0,0 +1,77 @@
+package actions
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func Test_HazardClass(t *testing.T) {
+	cases := []struct {
+		depth    float64
+		velocity float64
+		class    int
+	}{
+		{0, 5, 0},
+		{0.5, 0, 1},
+		{1, 0, 2},
+		{2, 0, 3},
+		{2, 3, 3},
+		{5, 0, 4},
+		{0.5, 8, 5},
+		{10, 0, 5},
+		{15, 0, 6},
+		{1, 15, 6},
+	}
+	for _, c := range cases {
+		if got := hazardClass(c.depth, c.velocity); got != c.class {
+			t.Errorf("expected %v ft at %v ft/s to be H%v, got H%v", c.depth, c.velocity, c.class, got)
+		}
+	}
+}
+
+func Test_HazardExceedance(t *testing.T) {
+	thresholds, err := parseDepthThresholds("2, 0, 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	//s has its first floor a foot above the ground, w is not in the inventory and has its first floor at the ground.
+	accumulator := initHazardExceedanceAccumulator(thresholds, map[string]float64{"s": 1})
+	blockCount, _, err := accumulateHazardExceedance(knownAnswerBlocks, 1, "%v.gpkg", 3, readKnownAnswerEvent, nil, accumulator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := accumulator.results(blockCount)
+	if len(results) != 2 || results[0].Fdid != "s" || results[1].Fdid != "w" {
+		t.Fatalf("expected results for s and w, got %v", results)
+	}
+	expected := []HazardExceedance{
+		{Fdid: "s", MaxDepth: 2, DepthAEP: []float64{0.1, 0, 0}, ClassAEP: []float64{0.2, 0.2, 0.1, 0, 0, 0}},
+		{Fdid: "w", MaxDepth: 0.5, DepthAEP: []float64{0.1, 0, 0}, ClassAEP: []float64{0.1, 0, 0, 0, 0, 0}},
+	}
+	for i, e := range expected {
+		r := results[i]
+		if r.MaxDepth != e.MaxDepth {
+			t.Errorf("expected a max depth of %v for %v, got %v", e.MaxDepth, e.Fdid, r.MaxDepth)
+		}
+		for j := range e.DepthAEP {
+			if math.Abs(r.DepthAEP[j]-e.DepthAEP[j]) > 1e-9 {
+				t.Errorf("expected %v to exceed %v ft with probability %v, got %v", e.Fdid, thresholds[j], e.DepthAEP[j], r.DepthAEP[j])
+			}
+		}
+		for j := range e.ClassAEP {
+			if math.Abs(r.ClassAEP[j]-e.ClassAEP[j]) > 1e-9 {
+				t.Errorf("expected %v to reach H%v with probability %v, got %v", e.Fdid, j+1, e.ClassAEP[j], r.ClassAEP[j])
+			}
+		}
+	}
+	sb := strings.Builder{}
+	err = writeHazardExceedanceCsv(&sb, thresholds, results)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(sb.String(), "\n")
+	if lines[0] != "fd_id,x,y,damcat,occtype,MaxDepth,MaxVel,AEP_D0,AEP_D1,AEP_D2,AEP_H1,AEP_H2,AEP_H3,AEP_H4,AEP_H5,AEP_H6" {
+		t.Errorf("unexpected header %v", lines[0])
+	}
+}
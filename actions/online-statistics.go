@@ -0,0 +1,176 @@
+package actions
+
+import (
+	"math"
+	"sort"
+)
+
+// OnlineStatistics accumulates the count, mean, sample variance, minimum and maximum of a stream of values in one pass using Welford's method.
+// quantiles requested at construction are estimated with the P-square algorithm without storing the values.
+type OnlineStatistics struct {
+	count     int
+	mean      float64
+	m2        float64 //sum of squared differences from the running mean
+	min       float64
+	max       float64
+	quantiles []*quantileSketch
+}
+
+// InitOnlineStatistics creates an empty accumulator that also estimates each of the requested quantiles, which must be between 0 and 1.
+func InitOnlineStatistics(quantiles ...float64) *OnlineStatistics {
+	st := &OnlineStatistics{min: math.Inf(1), max: math.Inf(-1), quantiles: make([]*quantileSketch, len(quantiles))}
+	for i, p := range quantiles {
+		st.quantiles[i] = initQuantileSketch(p)
+	}
+	return st
+}
+
+// Add includes a value in the statistics.
+func (st *OnlineStatistics) Add(value float64) {
+	st.count++
+	delta := value - st.mean
+	st.mean += delta / float64(st.count)
+	st.m2 += delta * (value - st.mean)
+	st.min = math.Min(st.min, value)
+	st.max = math.Max(st.max, value)
+	for _, q := range st.quantiles {
+		q.add(value)
+	}
+}
+
+func (st *OnlineStatistics) Count() int {
+	return st.count
+}
+func (st *OnlineStatistics) Mean() float64 {
+	return st.mean
+}
+
+// Variance returns the sample variance, which is zero until there are two values.
+func (st *OnlineStatistics) Variance() float64 {
+	if st.count < 2 {
+		return 0
+	}
+	return st.m2 / float64(st.count-1)
+}
+
+// StandardDeviation returns the square root of the sample variance.
+func (st *OnlineStatistics) StandardDeviation() float64 {
+	return math.Sqrt(st.Variance())
+}
+
+// StandardError returns the standard error of the mean, the standard deviation divided by the square root of the count.
+func (st *OnlineStatistics) StandardError() float64 {
+	if st.count == 0 {
+		return 0
+	}
+	return st.StandardDeviation() / math.Sqrt(float64(st.count))
+}
+
+// Min returns the smallest value, or zero when empty.
+func (st *OnlineStatistics) Min() float64 {
+	if st.count == 0 {
+		return 0
+	}
+	return st.min
+}
+
+// Max returns the largest value, or zero when empty.
+func (st *OnlineStatistics) Max() float64 {
+	if st.count == 0 {
+		return 0
+	}
+	return st.max
+}
+
+// Quantile returns the estimate of the i-th quantile requested at construction.
+func (st *OnlineStatistics) Quantile(i int) float64 {
+	return st.quantiles[i].value()
+}
+
+// quantileSketch estimates a single quantile with five markers (Jain and Chlamtac, 1985).
+type quantileSketch struct {
+	p         float64
+	count     int
+	heights   [5]float64
+	positions [5]float64
+	desired   [5]float64
+	increment [5]float64
+}
+
+func initQuantileSketch(p float64) *quantileSketch {
+	return &quantileSketch{
+		p:         p,
+		positions: [5]float64{1, 2, 3, 4, 5},
+		desired:   [5]float64{1, 1 + 2*p, 1 + 4*p, 3 + 2*p, 5},
+		increment: [5]float64{0, p / 2, p, (1 + p) / 2, 1},
+	}
+}
+
+func (qs *quantileSketch) add(value float64) {
+	//the first five values are kept exactly.
+	if qs.count < 5 {
+		qs.heights[qs.count] = value
+		qs.count++
+		if qs.count == 5 {
+			sort.Float64s(qs.heights[:])
+		}
+		return
+	}
+	qs.count++
+	k := 0
+	switch {
+	case value < qs.heights[0]:
+		qs.heights[0] = value
+	case value >= qs.heights[4]:
+		qs.heights[4] = value
+		k = 3
+	default:
+		for k = 0; k < 3 && value >= qs.heights[k+1]; k++ {
+		}
+	}
+	for i := k + 1; i < 5; i++ {
+		qs.positions[i]++
+	}
+	for i := range qs.desired {
+		qs.desired[i] += qs.increment[i]
+	}
+	//move the middle markers toward their desired positions.
+	for i := 1; i < 4; i++ {
+		d := qs.desired[i] - qs.positions[i]
+		if (d >= 1 && qs.positions[i+1]-qs.positions[i] > 1) || (d <= -1 && qs.positions[i-1]-qs.positions[i] < -1) {
+			step := 1.0
+			if d < 0 {
+				step = -1.0
+			}
+			h := qs.parabolic(i, step)
+			if qs.heights[i-1] < h && h < qs.heights[i+1] {
+				qs.heights[i] = h
+			} else {
+				qs.heights[i] = qs.linear(i, step)
+			}
+			qs.positions[i] += step
+		}
+	}
+}
+func (qs *quantileSketch) parabolic(i int, d float64) float64 {
+	n, q := qs.positions, qs.heights
+	return q[i] + d/(n[i+1]-n[i-1])*((n[i]-n[i-1]+d)*(q[i+1]-q[i])/(n[i+1]-n[i])+(n[i+1]-n[i]-d)*(q[i]-q[i-1])/(n[i]-n[i-1]))
+}
+func (qs *quantileSketch) linear(i int, d float64) float64 {
+	j := i + int(d)
+	return qs.heights[i] + d*(qs.heights[j]-qs.heights[i])/(qs.positions[j]-qs.positions[i])
+}
+
+// value returns the middle marker, with fewer than five values the exact quantile of those seen is used.
+func (qs *quantileSketch) value() float64 {
+	if qs.count == 0 {
+		return 0
+	}
+	if qs.count < 5 {
+		seen := make([]float64, qs.count)
+		copy(seen, qs.heights[:qs.count])
+		sort.Float64s(seen)
+		return percentile(seen, qs.p)
+	}
+	return qs.heights[2]
+}
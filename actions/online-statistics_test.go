@@ -0,0 +1,87 @@
+package actions
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func Test_OnlineStatisticsKnownValues(t *testing.T) {
+	st := InitOnlineStatistics()
+	for _, v := range []float64{2, 4, 4, 4, 5, 5, 7, 9} {
+		st.Add(v)
+	}
+	//the sample variance of this set is 32/7.
+	if st.Count() != 8 || st.Mean() != 5 || math.Abs(st.Variance()-32.0/7.0) > 1e-12 {
+		t.Errorf("expected a count of 8, a mean of 5 and a variance of %v, got %v, %v and %v", 32.0/7.0, st.Count(), st.Mean(), st.Variance())
+	}
+	if st.Min() != 2 || st.Max() != 9 {
+		t.Errorf("expected a min of 2 and a max of 9, got %v and %v", st.Min(), st.Max())
+	}
+	single := InitOnlineStatistics()
+	single.Add(3)
+	if single.Mean() != 3 || single.StandardDeviation() != 0 {
+		t.Errorf("expected a single value to have no spread, got %v", single.StandardDeviation())
+	}
+}
+
+func Test_OnlineStatisticsIsStableForLargeOffsets(t *testing.T) {
+	//a naive sum of squares loses all precision here.
+	st := InitOnlineStatistics()
+	for _, v := range []float64{1e9 + 4, 1e9 + 7, 1e9 + 13, 1e9 + 16} {
+		st.Add(v)
+	}
+	if math.Abs(st.Variance()-30) > 1e-6 {
+		t.Errorf("expected a variance of 30, got %v", st.Variance())
+	}
+}
+
+func Test_OnlineStatisticsNormal(t *testing.T) {
+	rng := rand.New(rand.NewSource(42))
+	st := InitOnlineStatistics(0.05, 0.5, 0.95)
+	for i := 0; i < 100000; i++ {
+		st.Add(10 + 2*rng.NormFloat64())
+	}
+	if math.Abs(st.Mean()-10) > 0.05 || math.Abs(st.StandardDeviation()-2) > 0.05 {
+		t.Errorf("expected a mean of 10 and a standard deviation of 2, got %v and %v", st.Mean(), st.StandardDeviation())
+	}
+	//the 5th and 95th percentiles of the normal are 1.645 standard deviations from the mean.
+	expected := []float64{10 - 2*1.6449, 10, 10 + 2*1.6449}
+	for i, e := range expected {
+		if math.Abs(st.Quantile(i)-e) > 0.1 {
+			t.Errorf("expected quantile %v to be near %v, got %v", i, e, st.Quantile(i))
+		}
+	}
+}
+
+func Test_OnlineStatisticsUniformQuantiles(t *testing.T) {
+	rng := rand.New(rand.NewSource(7))
+	st := InitOnlineStatistics(0.25, 0.9)
+	for i := 0; i < 50000; i++ {
+		st.Add(rng.Float64())
+	}
+	if math.Abs(st.Quantile(0)-0.25) > 0.01 || math.Abs(st.Quantile(1)-0.9) > 0.01 {
+		t.Errorf("expected uniform quantiles near 0.25 and 0.9, got %v and %v", st.Quantile(0), st.Quantile(1))
+	}
+	if math.Abs(st.Variance()-1.0/12.0) > 0.002 {
+		t.Errorf("expected a uniform variance near %v, got %v", 1.0/12.0, st.Variance())
+	}
+}
+
+func Test_ConvergenceDiagnostics(t *testing.T) {
+	wet := InitOnlineStatistics()
+	for _, v := range []float64{90, 110, 90, 110} {
+		wet.Add(v)
+	}
+	cd := convergenceDiagnostics([]*OnlineStatistics{nil, wet}, 0.1)
+	//the sample standard deviation is 11.547 and the standard error is 5.7735.
+	if cd.StandardErrors[0] != 0 || math.Abs(cd.StandardErrors[1]-5.7735) > 0.001 {
+		t.Errorf("expected standard errors of 0 and 5.7735, got %v", cd.StandardErrors)
+	}
+	if cd.Samples != 4 || math.Abs(cd.MaxRelativeSE-0.057735) > 0.00001 || !cd.Converged {
+		t.Errorf("expected 4 converged samples with a relative standard error of 0.057735, got %+v", cd)
+	}
+	if convergenceDiagnostics([]*OnlineStatistics{wet}, 0.05).Converged {
+		t.Error("expected a tolerance below the relative standard error to not converge")
+	}
+}
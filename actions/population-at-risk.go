@@ -0,0 +1,100 @@
+package actions
+
+import (
+	"errors"
+	"math"
+
+	"github.com/USACE/go-consequences/consequences"
+	"github.com/USACE/go-consequences/hazards"
+	"github.com/USACE/go-consequences/lifeloss"
+	"github.com/USACE/go-consequences/structures"
+	"github.com/USACE/go-consequences/warning"
+	"github.com/usace-cloud-compute/cc-go-sdk"
+)
+
+const (
+	lifeLossComplianceRateKey string = "lifeLossComplianceRate" //optional, the warning compliance rate between 0 and 1. life loss is only computed when provided.
+	lifeLossSeedKey           string = "lifeLossSeed"           //optional, defaults to 1234.
+	parDayHeader              string = "par_day"
+	parNightHeader            string = "par_night"
+	lifeLossHeader            string = "ll_tot"
+)
+
+// populationAtRisk appends the population of wet structures, and optionally the life loss, to compute results.
+type populationAtRisk struct {
+	lifeLoss *lifeloss.LifeLossEngine
+}
+
+// initPopulationAtRisk configures a life loss engine when a warning compliance rate is provided.
+func initPopulationAtRisk(attributes cc.PayloadAttributes) (populationAtRisk, error) {
+	par := populationAtRisk{}
+	complianceRate, err := attributes.GetFloat(lifeLossComplianceRateKey)
+	if err != nil {
+		return par, nil
+	}
+	if complianceRate < 0 || complianceRate > 1 {
+		return par, errors.New("the life loss compliance rate must be between 0 and 1")
+	}
+	seed := attributes.GetInt64OrDefault(lifeLossSeedKey, 1234)
+	engine := lifeloss.Init(seed, warning.InitComplianceBasedWarningSystem(seed, complianceRate))
+	par.lifeLoss = &engine
+	return par, nil
+}
+
+// wetPopulation returns the daytime (2pm) and nighttime (2am) population of a structure when its depth is above zero.
+func wetPopulation(s structures.StructureDeterministic, d hazards.HazardEvent) (int32, int32) {
+	if !d.Has(hazards.Depth) || d.Depth() <= 0 {
+		return 0, 0
+	}
+	return s.Pop2pmu65 + s.Pop2pmo65, s.Pop2amu65 + s.Pop2amo65
+}
+
+// appendTo adds the population at risk columns, and the life loss column when configured, to a structure result.
+func (par populationAtRisk) appendTo(r *consequences.Result, f consequences.Receptor, d hazards.HazardEvent) {
+	day, night := int32(0), int32(0)
+	s, ok := f.(structures.StructureDeterministic)
+	if ok {
+		day, night = wetPopulation(s, d)
+	}
+	r.Headers = append(r.Headers, parDayHeader, parNightHeader)
+	r.Result = append(r.Result, day, night)
+	if par.lifeLoss == nil {
+		return
+	}
+	//the warning and lethality steps use both the daytime and nighttime population.
+	ll := int32(0)
+	if ok && day+night > 0 {
+		ll = par.computeLifeLoss(s, d)
+	}
+	r.Headers = append(r.Headers, lifeLossHeader)
+	r.Result = append(r.Result, ll)
+}
+
+// computeLifeLoss runs the structure through the warning, stability and lethality steps, failures are treated as no life loss.
+func (par populationAtRisk) computeLifeLoss(s structures.StructureDeterministic, d hazards.HazardEvent) int32 {
+	stability, err := par.lifeLoss.EvaluateStabilityCriteria(d, s)
+	if err != nil {
+		return 0
+	}
+	remaining, err := par.lifeLoss.RedistributePopulation(d, s)
+	if err != nil {
+		return 0
+	}
+	r, err := par.lifeLoss.ComputeLifeLoss(d, remaining, stability)
+	if err != nil {
+		return 0
+	}
+	ll, err := r.Fetch(lifeLossHeader)
+	if err != nil {
+		return 0
+	}
+	if v, ok := ll.(int32); ok {
+		return v
+	}
+	return 0
+}
+
+// populationExposure is the population at risk used by the summaries, the larger of the daytime and nighttime population.
+func populationExposure(day float64, night float64) float64 {
+	return math.Max(day, night)
+}
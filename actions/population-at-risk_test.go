@@ -0,0 +1,75 @@
+package actions
+
+import (
+	"math"
+	"testing"
+
+	"github.com/USACE/go-consequences/hazards"
+	"github.com/USACE/go-consequences/structures"
+)
+
+func Test_WetPopulation(t *testing.T) {
+	s := structures.StructureDeterministic{PopulationSet: structures.PopulationSet{Pop2pmo65: 1, Pop2pmu65: 2, Pop2amo65: 3, Pop2amu65: 4}}
+	wet := hazards.DepthEvent{}
+	wet.SetDepth(1.5)
+	day, night := wetPopulation(s, &wet)
+	if day != 3 || night != 7 {
+		t.Errorf("expected a day population of 3 and a night population of 7, got %v and %v", day, night)
+	}
+	dry := hazards.DepthEvent{}
+	dry.SetDepth(0)
+	day, night = wetPopulation(s, &dry)
+	if day != 0 || night != 0 {
+		t.Errorf("expected no population at risk for a dry structure, got %v and %v", day, night)
+	}
+}
+
+func Test_AnnualPopulationAtRiskAndLifeLoss(t *testing.T) {
+	accumulator := InitBlockAccumulator(BlockMaximum)
+	err := accumulator.SetSpillDirectory(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer accumulator.Close()
+	//structure p has 8 people at risk in block 1 and 4 in block 3 with one life lost in block 3, block 2 and 4 are dry.
+	events := []ConsequenceResult{
+		{BlockNumber: 1, EventNumber: 1, Fdid: "p", Depth: 1, PopulationAtRisk: 8},
+		{BlockNumber: 1, EventNumber: 2, Fdid: "p", Depth: 0.5, PopulationAtRisk: 8},
+		{BlockNumber: 3, EventNumber: 5, Fdid: "p", Depth: 4, PopulationAtRisk: 4, LifeLoss: 1},
+	}
+	for b := int32(1); b <= 4; b++ {
+		err = accumulator.BeginBlock(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, r := range events {
+			if r.BlockNumber == b {
+				err = accumulator.Add(b, r)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+	}
+	err = accumulator.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = accumulator.EachStructure(func(v ConsequencesFrequencyResult) error {
+		v = computeFrequencyAAL(v, 4, 4)
+		if math.Abs(v.EAPAR-3) > 1e-9 || math.Abs(v.EALL-0.25) > 1e-9 {
+			t.Errorf("expected an EAPAR of 3 and an EALL of 0.25, got %v and %v", v.EAPAR, v.EALL)
+		}
+		if v.PopulationAtRisk[0].EventNumber != 1 || v.LifeLoss[0].BlockNumber != 3 {
+			t.Errorf("unexpected driving events %v and %v", v.PopulationAtRisk[0], v.LifeLoss[0])
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	curve := buildWatershedCurve(1, accumulator.WatershedBlockTotals(), 4, Weibull)
+	if curve.EAPAR != 3 || curve.EALL != 0.25 {
+		t.Errorf("expected a watershed EAPAR of 3 and EALL of 0.25, got %v and %v", curve.EAPAR, curve.EALL)
+	}
+}
@@ -0,0 +1,96 @@
+package actions
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// PlottingPosition describes how a rank in a sorted list of block values is converted into an exceedance probability.
+type PlottingPosition string
+
+const (
+	Weibull    PlottingPosition = "weibull"    // m/(n+1)
+	Gringorten PlottingPosition = "gringorten" // (m-0.44)/(n+0.12)
+	Cunnane    PlottingPosition = "cunnane"    // (m-0.4)/(n+0.2)
+)
+
+// ParsePlottingPosition converts an action attribute into a PlottingPosition, an empty string is treated as weibull.
+func ParsePlottingPosition(s string) (PlottingPosition, error) {
+	switch PlottingPosition(strings.ToLower(strings.TrimSpace(s))) {
+	case "", Weibull:
+		return Weibull, nil
+	case Gringorten:
+		return Gringorten, nil
+	case Cunnane:
+		return Cunnane, nil
+	default:
+		return Weibull, errors.New("unrecognized plotting position " + s + ", expected one of weibull, gringorten or cunnane")
+	}
+}
+
+// alpha is the constant a in the general plotting position formula (m-a)/(n+1-2a).
+func (pp PlottingPosition) alpha() float64 {
+	switch pp {
+	case Gringorten:
+		return 0.44
+	case Cunnane:
+		return 0.4
+	default:
+		return 0.0
+	}
+}
+
+// ExceedanceProbability returns the annual exceedance probability of the value ranked m (1 is the largest) out of n blocks.
+func (pp PlottingPosition) ExceedanceProbability(m int, n int) float64 {
+	a := pp.alpha()
+	return (float64(m) - a) / (float64(n) + 1.0 - 2.0*a)
+}
+
+// Ordinal returns the one based rank in a list of n blocks sorted largest to smallest that best represents the return period.
+// ok is false when the return period is rarer than the blocks can support.
+func (pp PlottingPosition) Ordinal(returnPeriod float64, n int) (int, bool) {
+	if returnPeriod <= 0 || n <= 0 {
+		return 0, false
+	}
+	a := pp.alpha()
+	m := int(math.Round((1.0/returnPeriod)*(float64(n)+1.0-2.0*a) + a))
+	if m < 1 {
+		return 0, false
+	}
+	if m > n {
+		m = n
+	}
+	return m, true
+}
+
+// parseReturnPeriods parses a comma separated list of return periods in years.
+func parseReturnPeriods(s string) ([]float64, error) {
+	parts := strings.Split(s, ",")
+	returnPeriods := make([]float64, 0, len(parts))
+	for _, p := range parts {
+		rp, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return nil, err
+		}
+		if rp <= 1 {
+			return nil, errors.New("return periods must be greater than one year, got " + p)
+		}
+		returnPeriods = append(returnPeriods, rp)
+	}
+	return returnPeriods, nil
+}
+
+// returnPeriodLabel formats a return period for use in column names, e.g. 100 becomes 100yr.
+func returnPeriodLabel(returnPeriod float64) string {
+	return strconv.FormatFloat(returnPeriod, 'f', -1, 64) + "yr"
+}
+
+// valueAtOrdinal returns the value at the one based ordinal of a list sorted largest to smallest, an ordinal beyond the list is zero.
+func valueAtOrdinal(values []BlockEventValue, ordinal int) float64 {
+	if ordinal < 1 || ordinal > len(values) {
+		return 0.0
+	}
+	return values[ordinal-1].Value
+}
@@ -0,0 +1,64 @@
+package actions
+
+import (
+	"math"
+	"testing"
+)
+
+func Test_PlottingPositionOrdinal(t *testing.T) {
+	cases := []struct {
+		pp           PlottingPosition
+		returnPeriod float64
+		blocks       int
+		ordinal      int
+		ok           bool
+	}{
+		{Weibull, 500, 1000, 2, true},
+		{Weibull, 10, 1000, 100, true},
+		{Weibull, 2, 1000, 501, true},
+		{Gringorten, 100, 1000, 10, true},
+		{Gringorten, 1000, 1000, 1, true},
+		{Cunnane, 2, 3, 2, true},
+		{Weibull, 1000, 100, 0, false},
+		{Cunnane, 1.1, 10, 10, true},
+	}
+	for _, c := range cases {
+		o, ok := c.pp.Ordinal(c.returnPeriod, c.blocks)
+		if o != c.ordinal || ok != c.ok {
+			t.Errorf("%v %v year with %v blocks: expected ordinal %v (%v), got %v (%v)", c.pp, c.returnPeriod, c.blocks, c.ordinal, c.ok, o, ok)
+		}
+	}
+}
+
+func Test_PlottingPositionExceedanceProbability(t *testing.T) {
+	if p := Weibull.ExceedanceProbability(1, 1000); math.Abs(p-1.0/1001.0) > 1e-12 {
+		t.Errorf("expected weibull to be 1/1001, got %v", p)
+	}
+	if p := Gringorten.ExceedanceProbability(1, 1000); math.Abs(p-0.56/1000.12) > 1e-12 {
+		t.Errorf("expected gringorten to be 0.56/1000.12, got %v", p)
+	}
+	if p := Cunnane.ExceedanceProbability(10, 10); math.Abs(p-9.6/10.2) > 1e-12 {
+		t.Errorf("expected cunnane to be 9.6/10.2, got %v", p)
+	}
+}
+
+func Test_ParseReturnPeriods(t *testing.T) {
+	rps, err := parseReturnPeriods("2, 5, 10, 25, 50, 100, 200, 500, 1000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rps) != 9 || rps[0] != 2 || rps[8] != 1000 {
+		t.Errorf("unexpected return periods %v", rps)
+	}
+	if returnPeriodLabel(rps[5]) != "100yr" || returnPeriodLabel(2.5) != "2.5yr" {
+		t.Errorf("unexpected return period labels")
+	}
+	_, err = parseReturnPeriods("1, 10")
+	if err == nil {
+		t.Errorf("expected a one year return period to be rejected")
+	}
+	_, err = ParsePlottingPosition("hazen")
+	if err == nil {
+		t.Errorf("expected hazen to be rejected")
+	}
+}
@@ -1,12 +1,13 @@
 package actions
 
 import (
+	"bufio"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
 	"os"
-	"sort"
+	"path/filepath"
 	"strconv"
 	"strings"
 
@@ -21,10 +22,19 @@ const (
 	realizationNumberKey                           string = "realizationNumber"
 	resultPathPatternKey                           string = "resultPathPattern"
 	realizationResultFilePathKey                   string = "realizationResultFilePath"
+	realizationJsonResultFilePathKey               string = "realizationJsonResultFilePath" //optional, defaults to the realization result file path with a .json extension.
 	outputTableNameKey                             string = "outputTableName"
 	spatialOutputDriverKey                         string = "spatialOutputDriver"
 	realizationSpatialResultsFilePathKey           string = "realizationSpatialResultFilePath"
 	eadOrdinateCapKey                              string = "eadOrdinateCap"
+	blockStatisticKey                              string = "blockStatistic"         //optional, one of max, sum or count-wet. defaults to max.
+	returnPeriodsKey                               string = "returnPeriods"          //optional, comma separated return periods in years. defaults to 500, 250, 100, 50, 10.
+	plottingPositionKey                            string = "plottingPosition"       //optional, one of weibull, gringorten or cunnane. defaults to weibull.
+	breakdownFilePathKey                           string = "breakdownFilePath"      //optional, aal by damage category and occupancy type.
+	eventBreakdownFilePathKey                      string = "eventBreakdownFilePath" //optional, event damages by damage category and occupancy type.
+	maxOpenDatasetsKey                             string = "maxOpenDatasets"        //optional, the number of event outputs read concurrently. defaults to 8.
+	spillDirectoryKey                              string = "spillDirectory"         //optional, local directory for intermediate block runs. defaults to the system temp directory.
+	defaultReturnPeriods                           string = "500, 250, 100, 50, 10"
 	summarizeOutputsActionName                     string = "summarize-outputs"
 	summarizeOutputsToBlocksActionName             string = "summarize-outputs-to-blocks"
 	summarizeOutputsToFrequencyActionName          string = "summarize-outputs-to-frequency"
@@ -34,7 +44,7 @@ const (
 func init() {
 	cc.ActionRegistry.RegisterAction(summarizeOutputsActionName, &SummarizeOutputsAction{})
 	cc.ActionRegistry.RegisterAction(summarizeOutputsToBlocksActionName, &SummarizeOutputsToBlocksAction{})
-	cc.ActionRegistry.RegisterAction(summarizeOutputsToFrequencyActionName, &SummarizeOutputsToWatershedFrequencyAction{})
+	cc.ActionRegistry.RegisterAction(summarizeOutputsToFrequencyActionName, &SummarizeOutputsToFrequencyAction{})
 	cc.ActionRegistry.RegisterAction(summarizeOutputsToWatershedFrequencyActionName, &SummarizeOutputsToWatershedFrequencyAction{})
 }
 
@@ -60,108 +70,39 @@ func (ar *SummarizeOutputsAction) Run() error {
 	tablename := a.Attributes.GetStringOrFail(tablenameKey)
 	driver := a.Attributes.GetStringOrFail(outputDriverKey) //driver
 	realizationResultFilePath := a.Attributes.GetStringOrFail(realizationResultFilePathKey)
+	maxOpenDatasets := a.Attributes.GetIntOrDefault(maxOpenDatasetsKey, defaultMaxOpenDatasets)
 	//get the block file
-	file, err := os.Open(blockFilePath)
-
+	blocks, report, reportPath, err := readValidatedBlocks(a.Attributes, blockFilePath, realizationNumber, realizationResultFilePath)
 	if err != nil {
 		return err
 	}
-	var blocks Blocks
-	err = json.NewDecoder(file).Decode(&blocks)
+	resultwriter, err := os.Create(realizationResultFilePath)
 	if err != nil {
+		fmt.Println(err)
 		return err
 	}
-	//prepare data structures for recieving results
-	realizationResults := make([]ConsequenceResult, 0)
-	for _, b := range blocks {
-		if b.RealizationIndex == realizationNumber {
-			//substitute event numbers
-			es := b.BlockEventStart
-			ee := b.BlockEventEnd
-			for i := es; i <= ee; i++ {
-				path := fmt.Sprintf(resultPathPattern, i)
-				//download geopackage
-				//read geopackage
-				driverOut := gdal.OGRDriverByName(driver)
-				ds, dsok := driverOut.Open(path, int(gdal.ReadOnly))
-				if !dsok {
-					fmt.Println("error opening file of type " + driver + " at " + path)
-				} else {
-					hasTable := false
-					for i := 0; i < ds.LayerCount(); i++ {
-						if tablename == ds.LayerByIndex(i).Name() {
-							hasTable = true
-						}
-					}
-					if !hasTable {
-						return errors.New("missing table " + tablename)
-					}
-					l := ds.LayerByName(tablename)
-					fc, _ := l.FeatureCount(true)
-					def := l.Definition()
-					idx := 0
-					for idx < fc { // Iterate and fetch the records from result cursor
-						f := l.NextFeature()
-						idx++
-						featureResult := ConsequenceResult{
-							EventNumber:       int32(i),
-							BlockNumber:       int32(b.BlockIndex),
-							RealizationNumber: int32(realizationNumber),
-							Fdid:              f.FieldAsString(def.FieldIndex("fd_id")),
-							X:                 f.FieldAsFloat64(def.FieldIndex("x")),
-							Y:                 f.FieldAsFloat64(def.FieldIndex("y")),
-							StructDamage:      f.FieldAsFloat64(def.FieldIndex("structure")),
-							ContentDamage:     f.FieldAsFloat64(def.FieldIndex("content da")),
-							Depth:             f.FieldAsFloat64(def.FieldIndex("depth")),
-							Velocity:          0, //velocity requires parsing the multi hazard json
-							Duration:          0,
-						}
-						multihazardString := f.FieldAsString(def.FieldIndex("multihazar"))
-						if strings.Contains(multihazardString, "\"velocity\":") {
-							velocity_partial := strings.Split(multihazardString, "\"velocity\":")[1]
-							velocity_string := strings.Split(velocity_partial, ",")[0]
-							velocity, err := strconv.ParseFloat(velocity_string, 64)
-							if err != nil {
-								fmt.Println("could not parse " + multihazardString + " for velocity")
-							} else {
-								featureResult.Velocity = velocity
-							}
-						}
-						if strings.Contains(multihazardString, "\"duration\":") {
-							duration_partial := strings.Split(multihazardString, "\"duration\":")[1]
-							duration_string := strings.Split(duration_partial, ",")[0]
-							duration, err := strconv.ParseFloat(duration_string, 64)
-							if err != nil {
-								fmt.Println("could not parse " + multihazardString + " for duration")
-							} else {
-								featureResult.Duration = duration
-							}
-						}
-
-						realizationResults = append(realizationResults, featureResult)
-					} //result rows
-				} //dataset exists
-
-			} //events
-
+	defer resultwriter.Close()
+	//rows are written as they are read so memory does not grow with the number of events.
+	w := bufio.NewWriter(resultwriter)
+	w.WriteString("realization,block,event,fd_id,x,y,sd,cd,td,depth,velocity,duration,damage_category,occupancy_type,par,life_loss\n")
+	err = readRealizationEvents(blocks, realizationNumber, resultPathPattern, maxOpenDatasets, gdalEventReader(driver, tablename), report, func(e EventResults) error {
+		for _, r := range e.Results {
+			_, err := fmt.Fprintf(w, "%v,%v,%v,%v,%v,%v,%.2f,%.2f,%.2f,%.5f,%.5f,%.2f,%v,%v,%v,%v\n", realizationNumber, r.BlockNumber, r.EventNumber, r.Fdid, r.X, r.Y, r.StructDamage, r.ContentDamage, r.StructDamage+r.ContentDamage, r.Depth, r.Velocity, r.Duration, r.DamageCategory, r.OccupancyType, r.PopulationAtRisk, r.LifeLoss)
+			if err != nil {
+				return err
+			}
 		}
-
-	}
-	// write out realization results
-	sb := strings.Builder{}
-	sb.WriteString("realization,block,event,fd_id,x,y,sd,cd,td,depth,velocity,duration\n")
-	for _, r := range realizationResults {
-		sb.WriteString(fmt.Sprintf("%v,%v,%v,%v,%v,%v,%.2f,%.2f,%.2f,%.5f,%.5f,%.2f\n", realizationNumber, r.BlockNumber, r.EventNumber, r.Fdid, r.X, r.Y, r.StructDamage, r.ContentDamage, r.StructDamage+r.ContentDamage, r.Depth, r.Velocity, r.Duration))
+		return nil
+	})
+	if err != nil {
+		report.Write(reportPath)
+		return err
 	}
-	resultwriter, err := os.Create(realizationResultFilePath)
-
+	err = w.Flush()
 	if err != nil {
-		fmt.Println(err)
 		return err
 	}
-
-	resultwriter.WriteString(sb.String())
-	return nil
+	return report.Write(reportPath)
 }
 
 type Blocks []Block
@@ -179,41 +120,56 @@ type ConsequenceResult struct { //one structure
 	Fdid              string  //fd_id
 	X                 float64 //x
 	Y                 float64 //y
+	DamageCategory    string  //damage cat
+	OccupancyType     string  //occupancy
 	StructDamage      float64 //structure
 	ContentDamage     float64 //content da
 	Depth             float64 //depth
 	Velocity          float64 //parse multihazar
 	Duration          float64 //not present - parse multihazar
+	PopulationAtRisk  float64 //the larger of par_day and par_night
+	LifeLoss          float64 //ll_tot
 }
 type EventValue struct {
 	EventNumber int32
 	Value       float64
 }
 type ConsequencesBlockResult struct {
-	Fdid            string  //fd_id
-	X               float64 //x
-	Y               float64 //y
-	StructureDamage EventValue
-	ContentDamage   EventValue
-	TotalDamage     EventValue
-	Depth           EventValue //depth
-	Velocity        EventValue //parse multihazar
-	Duration        EventValue
+	Fdid             string  //fd_id
+	X                float64 //x
+	Y                float64 //y
+	DamageCategory   string  //damage cat
+	OccupancyType    string  //occupancy
+	StructureDamage  EventValue
+	ContentDamage    EventValue
+	TotalDamage      EventValue
+	Depth            EventValue //depth
+	Velocity         EventValue //parse multihazar
+	Duration         EventValue
+	PopulationAtRisk EventValue
+	LifeLoss         EventValue
 }
 type ConsequencesFrequencyResult struct {
-	Fdid            string  //fd_id
-	X               float64 //x
-	Y               float64 //y
-	SAAL            float64
-	CAAL            float64
-	TAAL            float64
-	DAEP            float64
-	StructureDamage []BlockEventValue
-	ContentDamage   []BlockEventValue
-	TotalDamage     []BlockEventValue
-	Depth           []BlockEventValue //depth
-	Velocity        []BlockEventValue //parse multihazar
-	Duration        []BlockEventValue
+	Fdid             string  //fd_id
+	X                float64 //x
+	Y                float64 //y
+	DamageCategory   string  //damage cat
+	OccupancyType    string  //occupancy
+	SAAL             float64
+	CAAL             float64
+	TAAL             float64
+	DAEP             float64
+	EAPAR            float64 //expected annual population at risk
+	EALL             float64 //expected annual life loss
+	ResultBlocks     int     //blocks in which the structure had a result, before zero filling
+	StructureDamage  []BlockEventValue
+	ContentDamage    []BlockEventValue
+	TotalDamage      []BlockEventValue
+	Depth            []BlockEventValue //depth
+	Velocity         []BlockEventValue //parse multihazar
+	Duration         []BlockEventValue
+	PopulationAtRisk []BlockEventValue
+	LifeLoss         []BlockEventValue
 }
 type BlockEventValue struct {
 	BlockNumber int32
@@ -221,6 +177,200 @@ type BlockEventValue struct {
 	Value       float64
 }
 
+// errEventResultNotFound is returned when the compute output for an event could not be opened.
+var errEventResultNotFound = errors.New("event result not found")
+
+// readBlocks decodes the block file describing which events belong to each block of each realization.
+func readBlocks(blockFilePath string) (Blocks, error) {
+	file, err := os.Open(blockFilePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var blocks Blocks
+	err = json.NewDecoder(file).Decode(&blocks)
+	if err != nil {
+		return nil, err
+	}
+	return blocks, nil
+}
+
+// readValidatedBlocks reads the block file and validates the realization's blocks, returning the report and where it should be written.
+func readValidatedBlocks(attributes cc.PayloadAttributes, blockFilePath string, realizationNumber int, realizationResultFilePath string) (Blocks, *ManifestReport, string, error) {
+	mode, err := ParseValidationMode(attributes.GetStringOrDefault(validationModeKey, string(LenientValidation)))
+	if err != nil {
+		return nil, nil, "", err
+	}
+	reportPath := attributes.GetStringOrDefault(validationReportFilePathKey, defaultValidationReportPath(realizationResultFilePath))
+	blocks, err := readBlocks(blockFilePath)
+	if err != nil {
+		return nil, nil, reportPath, err
+	}
+	report, err := validateBlockManifest(blocks, realizationNumber, mode)
+	if err != nil {
+		report.Write(reportPath)
+		return nil, nil, reportPath, err
+	}
+	return blocks, report, reportPath, nil
+}
+
+// readEventResults reads every structure row of the compute output for a single event and returns the spatial reference of the table.
+// the event, block and realization numbers are left for the caller to set.
+func readEventResults(path string, driver string, tablename string, yield func(r ConsequenceResult) error) (string, error) {
+	//read geopackage
+	driverOut := gdal.OGRDriverByName(driver)
+	ds, dsok := driverOut.Open(path, int(gdal.ReadOnly))
+	if !dsok {
+		return "", fmt.Errorf("%w: error opening file of type %v at %v", errEventResultNotFound, driver, path)
+	}
+	defer ds.Destroy()
+	hasTable := false
+	for i := 0; i < ds.LayerCount(); i++ {
+		if tablename == ds.LayerByIndex(i).Name() {
+			hasTable = true
+		}
+	}
+	if !hasTable {
+		return "", errors.New("missing table " + tablename)
+	}
+	l := ds.LayerByName(tablename)
+	wkt, _ := l.SpatialReference().ToWKT()
+	fc, _ := l.FeatureCount(true)
+	def := l.Definition()
+	fdidIdx := def.FieldIndex("fd_id")
+	xIdx := def.FieldIndex("x")
+	yIdx := def.FieldIndex("y")
+	structureIdx := def.FieldIndex("structure")
+	contentIdx := def.FieldIndex("content da")
+	multihazardIdx := def.FieldIndex("multihazar")
+	damageCategoryIdx := def.FieldIndex("damage cat")
+	occupancyIdx := def.FieldIndex("occupancy")
+	parDayIdx := def.FieldIndex(parDayHeader)
+	parNightIdx := def.FieldIndex(parNightHeader)
+	lifeLossIdx := def.FieldIndex(lifeLossHeader)
+	idx := 0
+	for idx < fc { // Iterate and fetch the records from result cursor
+		f := l.NextFeature()
+		idx++
+		multihazardString := f.FieldAsString(multihazardIdx)
+		depth, err := parseMultiHazardString(multihazardString, "depth")
+		if err != nil {
+			f.Destroy()
+			return wkt, err
+		}
+		//velocity and duration are optional hazard parameters
+		velocity, err := parseMultiHazardString(multihazardString, "velocity")
+		if err != nil {
+			velocity = 0
+		}
+		duration, err := parseMultiHazardString(multihazardString, "duration")
+		if err != nil {
+			duration = 0
+		}
+		//older outputs may not carry the damage category or occupancy type
+		damageCategory := ""
+		if damageCategoryIdx >= 0 {
+			damageCategory = f.FieldAsString(damageCategoryIdx)
+		}
+		occupancyType := ""
+		if occupancyIdx >= 0 {
+			occupancyType = f.FieldAsString(occupancyIdx)
+		}
+		//population at risk and life loss are only present in newer outputs, life loss only when configured
+		parDay, parNight, lifeLoss := 0.0, 0.0, 0.0
+		if parDayIdx >= 0 && parNightIdx >= 0 {
+			parDay = f.FieldAsFloat64(parDayIdx)
+			parNight = f.FieldAsFloat64(parNightIdx)
+		}
+		if lifeLossIdx >= 0 {
+			lifeLoss = f.FieldAsFloat64(lifeLossIdx)
+		}
+		err = yield(ConsequenceResult{
+			Fdid:             f.FieldAsString(fdidIdx),
+			X:                f.FieldAsFloat64(xIdx),
+			Y:                f.FieldAsFloat64(yIdx),
+			DamageCategory:   damageCategory,
+			OccupancyType:    occupancyType,
+			StructDamage:     f.FieldAsFloat64(structureIdx),
+			ContentDamage:    f.FieldAsFloat64(contentIdx),
+			Depth:            depth,
+			Velocity:         velocity,
+			Duration:         duration,
+			PopulationAtRisk: populationExposure(parDay, parNight),
+			LifeLoss:         lifeLoss,
+		})
+		f.Destroy()
+		if err != nil {
+			return wkt, err
+		}
+	} //result rows
+	return wkt, nil
+}
+
+// accumulateBlocks reads every event of every block in the realization into a BlockAccumulator, reading up to maxOpen events concurrently.
+// it returns the number of blocks in the realization and the spatial reference of the event outputs.
+// missing events are recorded in the report.
+func accumulateBlocks(blocks Blocks, realizationNumber int, resultPathPattern string, driver string, tablename string, maxOpen int, report *ManifestReport, accumulator *BlockAccumulator) (int, string, error) {
+	return accumulateRealization(blocks, realizationNumber, resultPathPattern, maxOpen, gdalEventReader(driver, tablename), report, accumulator)
+}
+func accumulateRealization(blocks Blocks, realizationNumber int, resultPathPattern string, maxOpen int, read eventReaderFunc, report *ManifestReport, accumulator *BlockAccumulator) (int, string, error) {
+	blockCount := 0
+	for _, b := range blocks {
+		if b.RealizationIndex == realizationNumber {
+			blockCount += 1
+		}
+	}
+	//every block of the realization is begun in block file order, so blocks without events or results are dry rather than absent.
+	realizationBlocks := make([]int32, 0, blockCount)
+	for _, b := range blocks {
+		if b.RealizationIndex == realizationNumber {
+			realizationBlocks = append(realizationBlocks, int32(b.BlockIndex))
+		}
+	}
+	next := 0
+	beginThrough := func(block int32) error {
+		for next < len(realizationBlocks) {
+			b := realizationBlocks[next]
+			next++
+			err := accumulator.BeginBlock(b)
+			if err != nil {
+				return err
+			}
+			if b == block {
+				return nil
+			}
+		}
+		return nil
+	}
+	wkt := ""
+	err := readRealizationEvents(blocks, realizationNumber, resultPathPattern, maxOpen, read, report, func(e EventResults) error {
+		if wkt == "" {
+			wkt = e.Wkt
+		}
+		if next == 0 || realizationBlocks[next-1] != int32(e.Block.BlockIndex) {
+			err := beginThrough(int32(e.Block.BlockIndex))
+			if err != nil {
+				return err
+			}
+		}
+		for _, r := range e.Results {
+			err := accumulator.Add(int32(e.Block.BlockIndex), r)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return blockCount, wkt, err
+	}
+	err = beginThrough(-1)
+	if err != nil {
+		return blockCount, wkt, err
+	}
+	return blockCount, wkt, accumulator.Flush()
+}
+
 func (ar *SummarizeOutputsToBlocksAction) Run() error {
 	a := ar.Action
 	// get all relevant parameters
@@ -230,155 +380,45 @@ func (ar *SummarizeOutputsToBlocksAction) Run() error {
 	tablename := a.Attributes.GetStringOrFail(tablenameKey)
 	driver := a.Attributes.GetStringOrFail(outputDriverKey) //driver
 	realizationResultFilePath := a.Attributes.GetStringOrFail(realizationResultFilePathKey)
-	//get the block file
-	file, err := os.Open(blockFilePath)
-
+	maxOpenDatasets := a.Attributes.GetIntOrDefault(maxOpenDatasetsKey, defaultMaxOpenDatasets)
+	statistic, err := ParseBlockStatistic(a.Attributes.GetStringOrDefault(blockStatisticKey, string(BlockMaximum)))
 	if err != nil {
 		return err
 	}
-	var blocks Blocks
-	err = json.NewDecoder(file).Decode(&blocks)
+	//get the block file
+	blocks, report, reportPath, err := readValidatedBlocks(a.Attributes, blockFilePath, realizationNumber, realizationResultFilePath)
 	if err != nil {
 		return err
 	}
-	//prepare data structures for recieving results
-	realizationBlockResults := make(map[int32]map[string]ConsequencesBlockResult)
-	for _, b := range blocks {
-		if b.RealizationIndex == realizationNumber {
-			blockMap := make(map[string]ConsequencesBlockResult)
-			//substitute event numbers
-			es := b.BlockEventStart
-			ee := b.BlockEventEnd
-			for i := es; i <= ee; i++ {
-				path := fmt.Sprintf(resultPathPattern, i)
-				//download geopackage
-				//read geopackage
-				driverOut := gdal.OGRDriverByName(driver)
-				ds, dsok := driverOut.Open(path, int(gdal.ReadOnly))
-				if !dsok {
-					fmt.Println("error opening file of type " + driver + " at " + path)
-				} else {
-					hasTable := false
-					for i := 0; i < ds.LayerCount(); i++ {
-						if tablename == ds.LayerByIndex(i).Name() {
-							hasTable = true
-						}
-					}
-					if !hasTable {
-						return errors.New("missing table " + tablename)
-					}
-					l := ds.LayerByName(tablename)
-					fc, _ := l.FeatureCount(true)
-					def := l.Definition()
-					idx := 0
-					for idx < fc { // Iterate and fetch the records from result cursor
-						f := l.NextFeature()
-						idx++
-						fd_id := f.FieldAsString(def.FieldIndex("fd_id"))
-						sval := f.FieldAsFloat64(def.FieldIndex("structure"))
-						cval := f.FieldAsFloat64(def.FieldIndex("content da"))
-						multihazardString := f.FieldAsString(def.FieldIndex("multihazar"))
-						depth, err := parseMultiHazardString(multihazardString, "depth")
-						if err != nil {
-							return err
-						}
-						velocity, err := parseMultiHazardString(multihazardString, "velocity")
-						if err != nil {
-							log.Println(err)
-						}
-						duration, err := parseMultiHazardString(multihazardString, "duration")
-						if err != nil {
-							//log.Println(err)
-						}
-						result, ok := blockMap[fd_id]
-						if !ok {
-							//create first entry for the structure
-							result = ConsequencesBlockResult{
-								Fdid: fd_id,
-								X:    f.FieldAsFloat64(def.FieldIndex("x")),
-								Y:    f.FieldAsFloat64(def.FieldIndex("y")),
-								StructureDamage: EventValue{
-									EventNumber: int32(i),
-									Value:       sval,
-								},
-								ContentDamage: EventValue{
-									EventNumber: int32(i),
-									Value:       cval,
-								},
-								TotalDamage: EventValue{
-									EventNumber: int32(i),
-									Value:       sval + cval,
-								},
-								Depth: EventValue{
-									EventNumber: int32(i),
-									Value:       depth,
-								},
-								Velocity: EventValue{
-									EventNumber: int32(i),
-									Value:       velocity,
-								},
-								Duration: EventValue{
-									EventNumber: int32(i),
-									Value:       duration,
-								},
-							}
-						} else {
-							//update entry
-							if result.StructureDamage.Value > sval {
-								result.StructureDamage.EventNumber = int32(i)
-								result.StructureDamage.Value = sval
-							}
-							if result.ContentDamage.Value > cval {
-								result.ContentDamage.EventNumber = int32(i)
-								result.ContentDamage.Value = cval
-							}
-							if result.TotalDamage.Value > (sval + cval) {
-								result.TotalDamage.EventNumber = int32(i)
-								result.TotalDamage.Value = sval + cval
-							}
-							if result.Depth.Value > depth {
-								result.Depth.EventNumber = int32(i)
-								result.Depth.Value = depth
-							}
-							if result.Velocity.Value > velocity {
-								result.Velocity.EventNumber = int32(i)
-								result.Velocity.Value = velocity
-							}
-							if result.Duration.Value > duration {
-								result.Duration.EventNumber = int32(i)
-								result.Duration.Value = duration
-							}
-						}
-						blockMap[fd_id] = result
-					} //result rows
-				} //dataset exists
-
-			} //events
-			realizationBlockResults[int32(b.BlockIndex)] = blockMap
-		}
-
+	resultwriter, err := os.Create(realizationResultFilePath)
+	if err != nil {
+		fmt.Println(err)
+		return err
 	}
-	// write out realization results
-	sb := strings.Builder{}
-	sb.WriteString("realization,block,fd_id,x,y,sd_event,sd,cd_event,cd,td_event,td,depth_event,depth,velocity_event,velocity,duration_event,duration\n")
-	count := len(realizationBlockResults)
-	for b := 1; b < count; b++ {
-		m, ok := realizationBlockResults[int32(b)]
-		if ok {
-			for fdid, r := range m {
-				sb.WriteString(fmt.Sprintf("%v,%v,%v,%v,%v,%v,%.2f,%v,%.2f,%v,%.2f,%v,%.5f,%v,%.5f,%v,%.2f\n", realizationNumber, b, fdid, r.X, r.Y, r.StructureDamage.EventNumber, r.StructureDamage.Value, r.ContentDamage.EventNumber, r.ContentDamage.Value, r.TotalDamage.EventNumber, r.TotalDamage.Value, r.Depth.EventNumber, r.Depth.Value, r.Velocity.EventNumber, r.Velocity.Value, r.Duration.EventNumber, r.Duration.Value))
+	defer resultwriter.Close()
+	w := bufio.NewWriter(resultwriter)
+	w.WriteString("realization,block,fd_id,x,y,sd_event,sd,cd_event,cd,td_event,td,depth_event,depth,velocity_event,velocity,duration_event,duration,damage_category,occupancy_type,missing_events,par_event,par,life_loss_event,life_loss\n")
+	//each block is written as soon as it is complete, only one block is held in memory.
+	accumulator := InitBlockAccumulator(statistic)
+	accumulator.SetBlockHandler(func(block int32, results []ConsequencesBlockResult) error {
+		for _, r := range results {
+			_, err := fmt.Fprintf(w, "%v,%v,%v,%v,%v,%v,%.2f,%v,%.2f,%v,%.2f,%v,%.5f,%v,%.5f,%v,%.2f,%v,%v,%v,%v,%v,%v,%v\n", realizationNumber, block, r.Fdid, r.X, r.Y, r.StructureDamage.EventNumber, r.StructureDamage.Value, r.ContentDamage.EventNumber, r.ContentDamage.Value, r.TotalDamage.EventNumber, r.TotalDamage.Value, r.Depth.EventNumber, r.Depth.Value, r.Velocity.EventNumber, r.Velocity.Value, r.Duration.EventNumber, r.Duration.Value, r.DamageCategory, r.OccupancyType, report.MissingCount(block), r.PopulationAtRisk.EventNumber, r.PopulationAtRisk.Value, r.LifeLoss.EventNumber, r.LifeLoss.Value)
+			if err != nil {
+				return err
 			}
 		}
+		return nil
+	})
+	_, _, err = accumulateBlocks(blocks, realizationNumber, resultPathPattern, driver, tablename, maxOpenDatasets, report, accumulator)
+	if err != nil {
+		report.Write(reportPath)
+		return err
 	}
-	resultwriter, err := os.Create(realizationResultFilePath)
-
+	err = w.Flush()
 	if err != nil {
-		fmt.Println(err)
 		return err
 	}
-
-	resultwriter.WriteString(sb.String())
-	return nil
+	return report.Write(reportPath)
 }
 func (ar *SummarizeOutputsToWatershedFrequencyAction) Run() error {
 	a := ar.Action
@@ -389,263 +429,132 @@ func (ar *SummarizeOutputsToWatershedFrequencyAction) Run() error {
 	tablename := a.Attributes.GetStringOrFail(tablenameKey)
 	driver := a.Attributes.GetStringOrFail(outputDriverKey) //driver
 	realizationResultFilePath := a.Attributes.GetStringOrFail(realizationResultFilePathKey)
+	breakdownFilePath := a.Attributes.GetStringOrDefault(breakdownFilePathKey, "")
+	eventBreakdownFilePath := a.Attributes.GetStringOrDefault(eventBreakdownFilePathKey, "")
+	realizationJsonResultFilePath := a.Attributes.GetStringOrDefault(realizationJsonResultFilePathKey, strings.TrimSuffix(realizationResultFilePath, filepath.Ext(realizationResultFilePath))+".json")
+	maxOpenDatasets := a.Attributes.GetIntOrDefault(maxOpenDatasetsKey, defaultMaxOpenDatasets)
+	statistic, err := ParseBlockStatistic(a.Attributes.GetStringOrDefault(blockStatisticKey, string(BlockMaximum)))
+	if err != nil {
+		return err
+	}
+	plottingPosition, err := ParsePlottingPosition(a.Attributes.GetStringOrDefault(plottingPositionKey, string(Weibull)))
+	if err != nil {
+		return err
+	}
 
 	//get the block file
-	file, err := os.Open(blockFilePath)
-
+	blocks, report, reportPath, err := readValidatedBlocks(a.Attributes, blockFilePath, realizationNumber, realizationResultFilePath)
 	if err != nil {
 		return err
 	}
-	var blocks Blocks
-	err = json.NewDecoder(file).Decode(&blocks)
+	//prepare data structures for recieving results
+	accumulator := InitBlockAccumulator(statistic)
+	//event breakdowns are written as each block completes so events are not held in memory.
+	var eventwriter *bufio.Writer
+	if eventBreakdownFilePath != "" {
+		eventfile, err := os.Create(eventBreakdownFilePath)
+		if err != nil {
+			return err
+		}
+		defer eventfile.Close()
+		eventwriter = bufio.NewWriter(eventfile)
+		_, err = eventwriter.WriteString(eventBreakdownHeader)
+		if err != nil {
+			return err
+		}
+		accumulator.SetEventHandler(func(events []EventDamage) error {
+			return writeEventBreakdown(eventwriter, events)
+		})
+	}
+	blockCount, _, err := accumulateBlocks(blocks, realizationNumber, resultPathPattern, driver, tablename, maxOpenDatasets, report, accumulator)
 	if err != nil {
+		report.Write(reportPath)
 		return err
 	}
-	//prepare data structures for recieving results
-	blockCount := 0
-	realizationStructureResults := make(map[string]ConsequencesFrequencyResult)
-	realizationBlockWatershedTotalResults := make(map[int]float64)
-	wkt := ""
-	for _, b := range blocks {
-		if b.RealizationIndex == realizationNumber {
-			//substitute event numbers
-			es := b.BlockEventStart
-			ee := b.BlockEventEnd
-			blockCount += 1
-			blockTotalDamage := 0.0
-			for i := es; i <= ee; i++ {
-				path := fmt.Sprintf(resultPathPattern, i)
-				//download geopackage
-				//read geopackage
-				driverOut := gdal.OGRDriverByName(driver)
-				ds, dsok := driverOut.Open(path, int(gdal.ReadOnly))
-				if !dsok {
-					fmt.Println("error opening file of type " + driver + " at " + path)
-				} else {
-
-					hasTable := false
-					for i := 0; i < ds.LayerCount(); i++ {
-						if tablename == ds.LayerByIndex(i).Name() {
-							hasTable = true
-						}
-					}
-					if !hasTable {
-						return errors.New("missing table " + tablename)
-					}
-					l := ds.LayerByName(tablename)
-					if wkt == "" {
-						wkt, _ = l.SpatialReference().ToWKT()
-					}
-					fc, _ := l.FeatureCount(true)
-					def := l.Definition()
-					idx := 0
-					for idx < fc { // Iterate and fetch the records from result cursor
-						f := l.NextFeature()
-						idx++
-						fd_id := f.FieldAsString(def.FieldIndex("fd_id"))
-						sval := f.FieldAsFloat64(def.FieldIndex("structure"))
-						cval := f.FieldAsFloat64(def.FieldIndex("content da"))
-						multihazardString := f.FieldAsString(def.FieldIndex("multihazar"))
-						depth, err := parseMultiHazardString(multihazardString, "depth")
-						if err != nil {
-							return err
-						}
-						velocity, err := parseMultiHazardString(multihazardString, "velocity")
-						if err != nil {
-							log.Println(err)
-						}
-						duration, err := parseMultiHazardString(multihazardString, "duration")
-						if err != nil {
-							//log.Println(err)
-						}
-						result, ok := realizationStructureResults[fd_id]
-						if !ok {
-							//create first entry for the structure
-							result = ConsequencesFrequencyResult{
-								Fdid: fd_id,
-								X:    f.FieldAsFloat64(def.FieldIndex("x")),
-								Y:    f.FieldAsFloat64(def.FieldIndex("y")),
-								StructureDamage: []BlockEventValue{{
-									BlockNumber: int32(b.BlockIndex),
-									EventNumber: int32(i),
-									Value:       sval,
-								}},
-								ContentDamage: []BlockEventValue{{
-									BlockNumber: int32(b.BlockIndex),
-									EventNumber: int32(i),
-									Value:       cval,
-								}},
-								TotalDamage: []BlockEventValue{{
-									BlockNumber: int32(b.BlockIndex),
-									EventNumber: int32(i),
-									Value:       sval + cval,
-								}},
-								Depth: []BlockEventValue{{
-									BlockNumber: int32(b.BlockIndex),
-									EventNumber: int32(i),
-									Value:       depth,
-								}},
-								Velocity: []BlockEventValue{{
-									BlockNumber: int32(b.BlockIndex),
-									EventNumber: int32(i),
-									Value:       velocity,
-								}},
-								Duration: []BlockEventValue{{
-									BlockNumber: int32(b.BlockIndex),
-									EventNumber: int32(i),
-									Value:       duration,
-								}},
-							}
-						} else {
-							//entry already existed. check if last element matches block number
-							previous := len(result.StructureDamage) - 1
-							if result.StructureDamage[previous].BlockNumber == int32(b.BlockIndex) {
-								//update.
-								if result.StructureDamage[previous].Value > sval {
-									result.StructureDamage[previous].EventNumber = int32(i)
-									result.StructureDamage[previous].Value = sval
-								}
-								if result.ContentDamage[previous].Value > cval {
-									result.ContentDamage[previous].EventNumber = int32(i)
-									result.ContentDamage[previous].Value = cval
-								}
-								if result.TotalDamage[previous].Value > (sval + cval) {
-									result.TotalDamage[previous].EventNumber = int32(i)
-									result.TotalDamage[previous].Value = sval + cval
-								}
-								if result.Depth[previous].Value > depth {
-									result.Depth[previous].EventNumber = int32(i)
-									result.Depth[previous].Value = depth
-								}
-								if result.Velocity[previous].Value > velocity {
-									result.Velocity[previous].EventNumber = int32(i)
-									result.Velocity[previous].Value = velocity
-								}
-								if result.Duration[previous].Value > duration {
-									result.Duration[previous].EventNumber = int32(i)
-									result.Duration[previous].Value = duration
-								}
-							} else {
-								//assume we need to append a new value.
-								sdam := BlockEventValue{
-									BlockNumber: int32(b.BlockIndex),
-									EventNumber: int32(i),
-									Value:       sval,
-								}
-								result.StructureDamage = append(result.StructureDamage, sdam)
-								cdam := BlockEventValue{
-									BlockNumber: int32(b.BlockIndex),
-									EventNumber: int32(i),
-									Value:       cval,
-								}
-								result.ContentDamage = append(result.ContentDamage, cdam)
-								tdam := BlockEventValue{
-									BlockNumber: int32(b.BlockIndex),
-									EventNumber: int32(i),
-									Value:       sval + cval,
-								}
-								result.TotalDamage = append(result.TotalDamage, tdam)
-								dhaz := BlockEventValue{
-									BlockNumber: int32(b.BlockIndex),
-									EventNumber: int32(i),
-									Value:       depth,
-								}
-								result.Depth = append(result.Depth, dhaz)
-								vhaz := BlockEventValue{
-									BlockNumber: int32(b.BlockIndex),
-									EventNumber: int32(i),
-									Value:       velocity,
-								}
-								result.Velocity = append(result.Velocity, vhaz)
-								durhaz := BlockEventValue{
-									BlockNumber: int32(b.BlockIndex),
-									EventNumber: int32(i),
-									Value:       duration,
-								}
-								result.Duration = append(result.Duration, durhaz)
-
-							}
-
-						}
-						realizationStructureResults[fd_id] = result
-					} //result rows
-				} //dataset exists
-
-			} //events
-			//at the end of all events in a block, process the block maximum total loss across all structures.
-			for _, s := range realizationStructureResults {
-				for _, t := range s.TotalDamage {
-					if b.BlockIndex == int(t.BlockNumber) {
-						blockTotalDamage += t.Value
-					}
-				}
-
-			}
-			realizationBlockWatershedTotalResults[b.BlockIndex] = blockTotalDamage
+	//the watershed curve is the block totals sorted largest to smallest, the aal is their mean.
+	curve := buildWatershedCurve(realizationNumber, accumulator.WatershedBlockTotals(), blockCount, plottingPosition)
+	for i, o := range curve.Ordinates {
+		curve.Ordinates[i].MissingEvents = report.MissingCount(o.BlockNumber)
+	}
+	resultwriter, err := os.Create(realizationResultFilePath)
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+	defer resultwriter.Close()
+	err = curve.WriteCSV(resultwriter)
+	if err != nil {
+		return err
+	}
+	jsonwriter, err := os.Create(realizationJsonResultFilePath)
+	if err != nil {
+		return err
+	}
+	defer jsonwriter.Close()
+	err = curve.WriteJSON(jsonwriter)
+	if err != nil {
+		return err
+	}
+	//breakdowns are only written when requested and the compute outputs carry the columns.
+	if breakdownFilePath != "" {
+		breakdownwriter, err := os.Create(breakdownFilePath)
+		if err != nil {
+			return err
+		}
+		defer breakdownwriter.Close()
+		err = writeAALBreakdown(breakdownwriter, curve)
+		if err != nil {
+			return err
 		}
-
 	}
-	//sort
-	for k, v := range realizationStructureResults {
-		sort.Slice(v.StructureDamage, func(i int, j int) bool {
-			return v.StructureDamage[i].Value > v.StructureDamage[j].Value
-		})
-		sort.Slice(v.ContentDamage, func(i int, j int) bool {
-			return v.ContentDamage[i].Value > v.ContentDamage[j].Value
-		})
-		sort.Slice(v.TotalDamage, func(i int, j int) bool {
-			return v.TotalDamage[i].Value > v.TotalDamage[j].Value
-		})
-		sort.Slice(v.Depth, func(i int, j int) bool {
-			return v.Depth[i].Value > v.Depth[j].Value
-		})
-		sort.Slice(v.Velocity, func(i int, j int) bool {
-			return v.Velocity[i].Value > v.Velocity[j].Value
-		})
-		sort.Slice(v.Duration, func(i int, j int) bool {
-			return v.Duration[i].Value > v.Duration[j].Value
-		})
-		realizationStructureResults[k] = v
+	if eventwriter != nil {
+		err = eventwriter.Flush()
+		if err != nil {
+			return err
+		}
+	}
+	return report.Write(reportPath)
+}
+
+// computeFrequencyAAL averages the block values up to and including the zero based ordinateCap of a zero filled structure result over every block,
+// and sets DAEP to the fraction of blocks in which the structure had a result. both match the action before dry blocks were zero filled.
+func computeFrequencyAAL(v ConsequencesFrequencyResult, blockCount int, ordinateCap int) ConsequencesFrequencyResult {
+	v.SAAL, v.CAAL, v.TAAL, v.DAEP, v.EAPAR, v.EALL = 0, 0, 0, 0, 0, 0
+	if blockCount <= 0 {
+		return v
 	}
-	//compute ead
-	for k, v := range realizationStructureResults {
-		for _, val := range v.StructureDamage {
+	for i, val := range v.StructureDamage {
+		if i <= ordinateCap {
 			v.SAAL += val.Value
 		}
-		for _, val := range v.ContentDamage {
+	}
+	for i, val := range v.ContentDamage {
+		if i <= ordinateCap {
 			v.CAAL += val.Value
 		}
-		for _, val := range v.TotalDamage {
+	}
+	for i, val := range v.TotalDamage {
+		if i <= ordinateCap {
 			v.TAAL += val.Value
 		}
-		depthcount := blockCount - len(v.Depth)
-		v.SAAL = v.SAAL / float64(blockCount)
-		v.CAAL = v.CAAL / float64(blockCount)
-		v.TAAL = v.TAAL / float64(blockCount)
-		v.DAEP = 1.0 - (float64(depthcount) / float64(blockCount))
-		realizationStructureResults[k] = v
 	}
-	// write out realization results
-	sb := strings.Builder{}
-	/*sb.WriteString("blockid,TotalDamage\n")
-	for k, v := range realizationBlockWatershedTotalResults {
-		sb.WriteString(fmt.Sprintf("%v,%.2f\n", k, v))
-	}*/
-	sb.WriteString("aal\n")
-	totalAAL := 0.0
-	for _, v := range realizationStructureResults {
-		totalAAL += v.TAAL
+	for i, val := range v.PopulationAtRisk {
+		if i <= ordinateCap {
+			v.EAPAR += val.Value
+		}
 	}
-	sb.WriteString(fmt.Sprintf("%.2f\n", totalAAL))
-	resultwriter, err := os.Create(realizationResultFilePath)
-
-	if err != nil {
-		fmt.Println(err)
-		return err
+	for i, val := range v.LifeLoss {
+		if i <= ordinateCap {
+			v.EALL += val.Value
+		}
 	}
-
-	resultwriter.WriteString(sb.String())
-	return nil
+	v.SAAL = v.SAAL / float64(blockCount)
+	v.CAAL = v.CAAL / float64(blockCount)
+	v.TAAL = v.TAAL / float64(blockCount)
+	v.EAPAR = v.EAPAR / float64(blockCount)
+	v.EALL = v.EALL / float64(blockCount)
+	v.DAEP = float64(v.ResultBlocks) / float64(blockCount)
+	return v
 }
 func generateHazardRows(variable string, data []BlockEventValue) string {
 	s1 := fmt.Sprintf(",,,,,%v,%v", variable, "event_id")
@@ -681,363 +590,121 @@ func (ar *SummarizeOutputsToFrequencyAction) Run() error {
 	tablename := a.Attributes.GetStringOrFail(tablenameKey)
 	driver := a.Attributes.GetStringOrFail(outputDriverKey) //driver
 	realizationResultFilePath := a.Attributes.GetStringOrFail(realizationResultFilePathKey)
+	maxOpenDatasets := a.Attributes.GetIntOrDefault(maxOpenDatasetsKey, defaultMaxOpenDatasets)
 	outDriver := a.Attributes.GetStringOrFail(spatialOutputDriverKey)
 	outTableName := a.Attributes.GetStringOrFail(outputTableNameKey)
 	realizationSpatialResultFilePath := a.Attributes.GetStringOrFail(realizationSpatialResultsFilePathKey)
 	eadOrdinateCap := a.Attributes.GetIntOrFail(eadOrdinateCapKey)
-	//get the block file
-	file, err := os.Open(blockFilePath)
-
+	returnPeriods, err := parseReturnPeriods(a.Attributes.GetStringOrDefault(returnPeriodsKey, defaultReturnPeriods))
 	if err != nil {
 		return err
 	}
-	var blocks Blocks
-	err = json.NewDecoder(file).Decode(&blocks)
+	plottingPosition, err := ParsePlottingPosition(a.Attributes.GetStringOrDefault(plottingPositionKey, string(Weibull)))
 	if err != nil {
 		return err
 	}
-	//prepare data structures for recieving results
-	blockCount := 0
-	realizationStructureResults := make(map[string]ConsequencesFrequencyResult)
-	wkt := ""
-	for _, b := range blocks {
-		if b.RealizationIndex == realizationNumber {
-			//substitute event numbers
-			es := b.BlockEventStart
-			ee := b.BlockEventEnd
-			blockCount += 1
-			for i := es; i <= ee; i++ {
-				path := fmt.Sprintf(resultPathPattern, i)
-				//download geopackage
-				//read geopackage
-				driverOut := gdal.OGRDriverByName(driver)
-				ds, dsok := driverOut.Open(path, int(gdal.ReadOnly))
-				if !dsok {
-					fmt.Println("error opening file of type " + driver + " at " + path)
-				} else {
-
-					hasTable := false
-					for i := 0; i < ds.LayerCount(); i++ {
-						if tablename == ds.LayerByIndex(i).Name() {
-							hasTable = true
-						}
-					}
-					if !hasTable {
-						return errors.New("missing table " + tablename)
-					}
-					l := ds.LayerByName(tablename)
-					if wkt == "" {
-						wkt, _ = l.SpatialReference().ToWKT()
-					}
-					fc, _ := l.FeatureCount(true)
-					def := l.Definition()
-					idx := 0
-					for idx < fc { // Iterate and fetch the records from result cursor
-						f := l.NextFeature()
-						idx++
-						fd_id := f.FieldAsString(def.FieldIndex("fd_id"))
-						sval := f.FieldAsFloat64(def.FieldIndex("structure"))
-						cval := f.FieldAsFloat64(def.FieldIndex("content da"))
-						multihazardString := f.FieldAsString(def.FieldIndex("multihazar"))
-						depth, err := parseMultiHazardString(multihazardString, "depth")
-						if err != nil {
-							return err
-						}
-						velocity, err := parseMultiHazardString(multihazardString, "velocity")
-						if err != nil {
-							log.Println(err)
-						}
-						duration, err := parseMultiHazardString(multihazardString, "duration")
-						if err != nil {
-							//log.Println(err)
-						}
-						result, ok := realizationStructureResults[fd_id]
-						if !ok {
-							//create first entry for the structure
-							result = ConsequencesFrequencyResult{
-								Fdid: fd_id,
-								X:    f.FieldAsFloat64(def.FieldIndex("x")),
-								Y:    f.FieldAsFloat64(def.FieldIndex("y")),
-								StructureDamage: []BlockEventValue{{
-									BlockNumber: int32(b.BlockIndex),
-									EventNumber: int32(i),
-									Value:       sval,
-								}},
-								ContentDamage: []BlockEventValue{{
-									BlockNumber: int32(b.BlockIndex),
-									EventNumber: int32(i),
-									Value:       cval,
-								}},
-								TotalDamage: []BlockEventValue{{
-									BlockNumber: int32(b.BlockIndex),
-									EventNumber: int32(i),
-									Value:       sval + cval,
-								}},
-								Depth: []BlockEventValue{{
-									BlockNumber: int32(b.BlockIndex),
-									EventNumber: int32(i),
-									Value:       depth,
-								}},
-								Velocity: []BlockEventValue{{
-									BlockNumber: int32(b.BlockIndex),
-									EventNumber: int32(i),
-									Value:       velocity,
-								}},
-								Duration: []BlockEventValue{{
-									BlockNumber: int32(b.BlockIndex),
-									EventNumber: int32(i),
-									Value:       duration,
-								}},
-							}
-						} else {
-							//entry already existed. check if last element matches block number
-							previous := len(result.StructureDamage) - 1
-							if result.StructureDamage[previous].BlockNumber == int32(b.BlockIndex) {
-								//update.
-								if result.StructureDamage[previous].Value > sval {
-									result.StructureDamage[previous].EventNumber = int32(i)
-									result.StructureDamage[previous].Value = sval
-								}
-								if result.ContentDamage[previous].Value > cval {
-									result.ContentDamage[previous].EventNumber = int32(i)
-									result.ContentDamage[previous].Value = cval
-								}
-								if result.TotalDamage[previous].Value > (sval + cval) {
-									result.TotalDamage[previous].EventNumber = int32(i)
-									result.TotalDamage[previous].Value = sval + cval
-								}
-								if result.Depth[previous].Value > depth {
-									result.Depth[previous].EventNumber = int32(i)
-									result.Depth[previous].Value = depth
-								}
-								if result.Velocity[previous].Value > velocity {
-									result.Velocity[previous].EventNumber = int32(i)
-									result.Velocity[previous].Value = velocity
-								}
-								if result.Duration[previous].Value > duration {
-									result.Duration[previous].EventNumber = int32(i)
-									result.Duration[previous].Value = duration
-								}
-							} else {
-								//assume we need to append a new value.
-								sdam := BlockEventValue{
-									BlockNumber: int32(b.BlockIndex),
-									EventNumber: int32(i),
-									Value:       sval,
-								}
-								result.StructureDamage = append(result.StructureDamage, sdam)
-								cdam := BlockEventValue{
-									BlockNumber: int32(b.BlockIndex),
-									EventNumber: int32(i),
-									Value:       cval,
-								}
-								result.ContentDamage = append(result.ContentDamage, cdam)
-								tdam := BlockEventValue{
-									BlockNumber: int32(b.BlockIndex),
-									EventNumber: int32(i),
-									Value:       sval + cval,
-								}
-								result.TotalDamage = append(result.TotalDamage, tdam)
-								dhaz := BlockEventValue{
-									BlockNumber: int32(b.BlockIndex),
-									EventNumber: int32(i),
-									Value:       depth,
-								}
-								result.Depth = append(result.Depth, dhaz)
-								vhaz := BlockEventValue{
-									BlockNumber: int32(b.BlockIndex),
-									EventNumber: int32(i),
-									Value:       velocity,
-								}
-								result.Velocity = append(result.Velocity, vhaz)
-								durhaz := BlockEventValue{
-									BlockNumber: int32(b.BlockIndex),
-									EventNumber: int32(i),
-									Value:       duration,
-								}
-								result.Duration = append(result.Duration, durhaz)
-
-							}
-
-						}
-						realizationStructureResults[fd_id] = result
-					} //result rows
-				} //dataset exists
-
-			} //events
-		}
-
+	statistic, err := ParseBlockStatistic(a.Attributes.GetStringOrDefault(blockStatisticKey, string(BlockMaximum)))
+	if err != nil {
+		return err
 	}
-	//sort
-	for k, v := range realizationStructureResults {
-		sort.Slice(v.StructureDamage, func(i int, j int) bool {
-			return v.StructureDamage[i].Value > v.StructureDamage[j].Value
-		})
-		sort.Slice(v.ContentDamage, func(i int, j int) bool {
-			return v.ContentDamage[i].Value > v.ContentDamage[j].Value
-		})
-		sort.Slice(v.TotalDamage, func(i int, j int) bool {
-			return v.TotalDamage[i].Value > v.TotalDamage[j].Value
-		})
-		sort.Slice(v.Depth, func(i int, j int) bool {
-			return v.Depth[i].Value > v.Depth[j].Value
-		})
-		sort.Slice(v.Velocity, func(i int, j int) bool {
-			return v.Velocity[i].Value > v.Velocity[j].Value
-		})
-		sort.Slice(v.Duration, func(i int, j int) bool {
-			return v.Duration[i].Value > v.Duration[j].Value
-		})
-		realizationStructureResults[k] = v
+	//get the block file
+	blocks, report, reportPath, err := readValidatedBlocks(a.Attributes, blockFilePath, realizationNumber, realizationResultFilePath)
+	if err != nil {
+		return err
 	}
-	//compute ead
-	//cap at the 10 year or the 50th ordinate
-
-	for k, v := range realizationStructureResults {
-		for i, val := range v.StructureDamage {
-			if i <= eadOrdinateCap {
-				v.SAAL += val.Value
-			}
-
-		}
-		for i, val := range v.ContentDamage {
-			if i <= eadOrdinateCap {
-				v.CAAL += val.Value
-			}
-		}
-		for i, val := range v.TotalDamage {
-			if i <= eadOrdinateCap {
-				v.TAAL += val.Value
-			}
-		}
-		depthcount := blockCount - len(v.Depth)
-		v.SAAL = v.SAAL / float64(blockCount)
-		v.CAAL = v.CAAL / float64(blockCount)
-		v.TAAL = v.TAAL / float64(blockCount)
-		v.DAEP = 1.0 - (float64(depthcount) / float64(blockCount))
-		realizationStructureResults[k] = v
+	//prepare data structures for recieving results, completed blocks are spilled to disk and merged per structure.
+	accumulator := InitBlockAccumulator(statistic)
+	err = accumulator.SetSpillDirectory(a.Attributes.GetStringOrDefault(spillDirectoryKey, os.TempDir()))
+	if err != nil {
+		return err
+	}
+	defer accumulator.Close()
+	blockCount, wkt, err := accumulateBlocks(blocks, realizationNumber, resultPathPattern, driver, tablename, maxOpenDatasets, report, accumulator)
+	if err != nil {
+		report.Write(reportPath)
+		return err
 	}
 	rw, err := resultswriters.InitSpatialResultsWriter_WKT_Projected(realizationSpatialResultFilePath, outTableName, outDriver, wkt)
 	if err != nil {
-		panic(err)
+		return err
+	}
+	defer rw.Close()
+	resultwriter, err := os.Create(realizationResultFilePath)
+	if err != nil {
+		fmt.Println(err)
+		return err
 	}
+	defer resultwriter.Close()
+	w := bufio.NewWriter(resultwriter)
 
 	// write out realization results
-	sb := strings.Builder{}
-	sb.WriteString("fd_id,x,y,SAAL,CAAL,TAAL,DAEP")
-	rh := []string{"fd_id", "x", "y", "SAAL", "CAAL", "TAAL", "DAEP", "500yrDam", "250yrDam", "100yrDam", "50yrDam", "10yrDam", "500yrD", "250yrD", "100yrD", "50yrD", "10yrD", "500yrV", "250yrV", "100yrV", "50yrV", "10yrV"}
+	w.WriteString("fd_id,x,y,SAAL,CAAL,TAAL,DAEP")
+	rh := []string{"fd_id", "x", "y", "damcat", "occtype", "SAAL", "CAAL", "TAAL", "DAEP", "EAPAR", "EALL"}
+	//ordinals are ranks in the block values sorted largest to smallest, an ordinal of zero is rarer than the blocks support.
+	ordinals := make([]int, len(returnPeriods))
+	for i, rp := range returnPeriods {
+		o, ok := plottingPosition.Ordinal(rp, blockCount)
+		if !ok {
+			log.Printf("the %v return period is rarer than %v blocks can support with the %v plotting position, reporting zero\n", rp, blockCount, plottingPosition)
+		}
+		ordinals[i] = o
+	}
+	for _, rp := range returnPeriods {
+		rh = append(rh, returnPeriodLabel(rp)+"Dam")
+	}
+	for _, rp := range returnPeriods {
+		rh = append(rh, returnPeriodLabel(rp)+"D")
+	}
+	for _, rp := range returnPeriods {
+		rh = append(rh, returnPeriodLabel(rp)+"V")
+	}
 
 	for b := 1; b <= blockCount; b++ {
-		sb.WriteString(fmt.Sprintf(",%.5f", float32(b)/float32(blockCount)))
+		w.WriteString(fmt.Sprintf(",%.5f", plottingPosition.ExceedanceProbability(b, blockCount)))
 	}
-	sb.WriteString("\n")
-
-	for _, v := range realizationStructureResults {
-		/*var dam500 int32 = 0 //0.0
-		var dam250 int32 = 0 //0.0
-		var dam100 int32 = 0 //0.0
-		var dam50 int32 = 0  //0.0
-		var dam10 int32 = 0  //0.0
-		var d500 int32 = 0   //0.0
-		var d250 int32 = 0   //0.0
-		var d100 int32 = 0   //0.0
-		var d50 int32 = 0    //0.0
-		var d10 int32 = 0    //0.0
-		var v500 int32 = 0   //0.0
-		var v250 int32 = 0   //0.0
-		var v100 int32 = 0   //0.0
-		var v50 int32 = 0    //0.0
-		var v10 int32 = 0    //0.0
-		*/
-		var dam500 float64 = 0.0 //0.0
-		var dam250 float64 = 0.0 //0.0
-		var dam100 float64 = 0.0 //0.0
-		var dam50 float64 = 0.0  //0.0
-		var dam10 float64 = 0.0  //0.0
-		var d500 float64 = 0.0   //0.0
-		var d250 float64 = 0.0   //0.0
-		var d100 float64 = 0.0   //0.0
-		var d50 float64 = 0.0    //0.0
-		var d10 float64 = 0.0    //0.0
-		var v500 float64 = 0.0   //0.0
-		var v250 float64 = 0.0   //0.0
-		var v100 float64 = 0.0   //0.0
-		var v50 float64 = 0.0    //0.0
-		var v10 float64 = 0.0    //0.0
-		/*if len(v.TotalDamage) >= 50 {
-			dam10 = v.TotalDamage[50-1].EventNumber //Value
-			d10 = v.Depth[50-1].EventNumber         //Value
-			v10 = v.Velocity[50-1].EventNumber      //Value
-		}
-		if len(v.TotalDamage) >= 10 {
-			dam50 = v.TotalDamage[10-1].EventNumber //Value
-			d50 = v.Depth[10-1].EventNumber         //Value
-			v50 = v.Velocity[10-1].EventNumber      //Value
+	w.WriteString("\n")
+
+	//structures arrive in fd_id order so outputs are reproducible.
+	err = accumulator.EachStructure(func(v ConsequencesFrequencyResult) error {
+		//compute ead
+		//cap at the 10 year or the 50th ordinate
+		v = computeFrequencyAAL(v, blockCount, eadOrdinateCap)
+		result := []interface{}{v.Fdid, v.X, v.Y, v.DamageCategory, v.OccupancyType, v.SAAL, v.CAAL, v.TAAL, v.DAEP, v.EAPAR, v.EALL}
+		for _, o := range ordinals {
+			result = append(result, valueAtOrdinal(v.TotalDamage, o))
 		}
-		if len(v.TotalDamage) >= 5 {
-			dam100 = v.TotalDamage[5-1].EventNumber //Value
-			d100 = v.Depth[5-1].EventNumber         //Value
-			v100 = v.Velocity[5-1].EventNumber      //Value
+		for _, o := range ordinals {
+			result = append(result, valueAtOrdinal(v.Depth, o))
 		}
-		if len(v.TotalDamage) >= 2 {
-			dam250 = v.TotalDamage[2-1].EventNumber //Value
-			d250 = v.Depth[2-1].EventNumber         //Value
-			v250 = v.Velocity[2-1].EventNumber      //Value
-		}
-		if len(v.TotalDamage) >= 1 {
-			dam500 = v.TotalDamage[0].EventNumber //Value
-			d500 = v.Depth[0].EventNumber         //Value
-			v500 = v.Velocity[0].EventNumber      //Value
-		}
-		*/
-		if len(v.TotalDamage) >= 50 {
-			dam10 = v.TotalDamage[50-1].Value
-			d10 = v.Depth[50-1].Value
-			v10 = v.Velocity[50-1].Value
-		}
-		if len(v.TotalDamage) >= 10 {
-			dam50 = v.TotalDamage[10-1].Value
-			d50 = v.Depth[10-1].Value
-			v50 = v.Velocity[10-1].Value
-		}
-		if len(v.TotalDamage) >= 5 {
-			dam100 = v.TotalDamage[5-1].Value
-			d100 = v.Depth[5-1].Value
-			v100 = v.Velocity[5-1].Value
-		}
-		if len(v.TotalDamage) >= 2 {
-			dam250 = v.TotalDamage[2-1].Value
-			d250 = v.Depth[2-1].Value
-			v250 = v.Velocity[2-1].Value
-		}
-		if len(v.TotalDamage) >= 1 {
-			dam500 = v.TotalDamage[0].Value
-			d500 = v.Depth[0].Value
-			v500 = v.Velocity[0].Value
+		for _, o := range ordinals {
+			result = append(result, valueAtOrdinal(v.Velocity, o))
 		}
 		cr := consequences.Result{
 			Headers: rh,
-			Result:  []interface{}{v.Fdid, v.X, v.Y, v.SAAL, v.CAAL, v.TAAL, v.DAEP, dam500, dam250, dam100, dam50, dam10, d500, d250, d100, d50, d10, v500, v250, v100, v50, v10},
+			Result:  result,
 		}
 		rw.Write(cr)
-		sb.WriteString(fmt.Sprintf("%v,%v,%v,%.2f,%.2f,%.2f,%.4f\n", v.Fdid, v.X, v.Y, v.SAAL, v.CAAL, v.TAAL, v.DAEP))
+		w.WriteString(fmt.Sprintf("%v,%v,%v,%.2f,%.2f,%.2f,%.4f\n", v.Fdid, v.X, v.Y, v.SAAL, v.CAAL, v.TAAL, v.DAEP))
 		//now write three rows per frequency curve.
-		sb.WriteString(generateHazardRows("structure_damage", v.StructureDamage))
-		sb.WriteString(generateHazardRows("content_damage", v.ContentDamage))
-		sb.WriteString(generateHazardRows("total_damage", v.TotalDamage))
-		sb.WriteString(generateHazardRows("depth", v.Depth))
-		sb.WriteString(generateHazardRows("velocity", v.Velocity))
-		sb.WriteString(generateHazardRows("duration", v.Duration))
+		w.WriteString(generateHazardRows("structure_damage", v.StructureDamage))
+		w.WriteString(generateHazardRows("content_damage", v.ContentDamage))
+		w.WriteString(generateHazardRows("total_damage", v.TotalDamage))
+		w.WriteString(generateHazardRows("depth", v.Depth))
+		w.WriteString(generateHazardRows("velocity", v.Velocity))
+		w.WriteString(generateHazardRows("duration", v.Duration))
+		w.WriteString(generateHazardRows("population_at_risk", v.PopulationAtRisk))
+		_, err := w.WriteString(generateHazardRows("life_loss", v.LifeLoss))
+		return err
+	})
+	if err != nil {
+		return err
 	}
-
-	resultwriter, err := os.Create(realizationResultFilePath)
-
+	err = w.Flush()
 	if err != nil {
-		fmt.Println(err)
 		return err
 	}
-
-	resultwriter.WriteString(sb.String())
-	rw.Close()
-	return nil
+	if len(report.MissingEvents) > 0 {
+		log.Printf("realization %v is missing %v of %v events, see %v\n", realizationNumber, len(report.MissingEvents), report.EventCount, reportPath)
+	}
+	return report.Write(reportPath)
 }
@@ -0,0 +1,143 @@
+package actions
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/USACE/go-consequences/consequences"
+	"github.com/USACE/go-consequences/hazards"
+	"github.com/USACE/go-consequences/resultswriters"
+	"github.com/dewberry/gdal"
+	"github.com/usace-cloud-compute/cc-go-sdk"
+)
+
+// writeSyntheticEventResults writes a compute-event style geopackage for every event in syntheticStructureDamage
+// and a block file describing them, returning the block file path and the result path pattern.
+func writeSyntheticEventResults(t *testing.T) (string, string) {
+	root := t.TempDir()
+	blockFilePath := filepath.Join(root, "blockfile.json")
+	err := os.WriteFile(blockFilePath, []byte(syntheticBlockFile), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	locations := map[string][]float64{"a": {-77.01, 38.91}, "b": {-77.02, 38.92}}
+	header := []string{"fd_id", "x", "y", "structure damage", "content damage", "multihazard"}
+	for e, structures := range syntheticStructureDamage {
+		dir := filepath.Join(root, fmt.Sprint(e))
+		err := os.MkdirAll(dir, 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rw, err := resultswriters.InitSpatialResultsWriter(filepath.Join(dir, "consequences.gpkg"), outputLayerName, "GPKG")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for fdid, sd := range structures {
+			h := hazards.HazardDataToMultiParameter(hazards.HazardData{Depth: sd / 10, Velocity: sd / 20})
+			b, err := json.Marshal(h)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rw.Write(consequences.Result{
+				Headers: header,
+				Result:  []interface{}{fdid, locations[fdid][0], locations[fdid][1], sd, sd / 2, string(b)},
+			})
+		}
+		rw.Close()
+	}
+	return blockFilePath, filepath.Join(root, "%v", "consequences.gpkg")
+}
+
+func Test_SummarizeOutputsToFrequencyRegistration(t *testing.T) {
+	ar, ok := cc.ActionRegistry[summarizeOutputsToFrequencyActionName]
+	if !ok {
+		t.Fatalf("%v is not registered", summarizeOutputsToFrequencyActionName)
+	}
+	if _, ok := ar.(*SummarizeOutputsToFrequencyAction); !ok {
+		t.Errorf("%v is registered with %T", summarizeOutputsToFrequencyActionName, ar)
+	}
+}
+
+func Test_SummarizeOutputsToFrequencyEndToEnd(t *testing.T) {
+	blockFilePath, resultPathPattern := writeSyntheticEventResults(t)
+	outputDir := t.TempDir()
+	csvPath := filepath.Join(outputDir, "realization_1_frequency_consequences.csv")
+	spatialPath := filepath.Join(outputDir, "realization_1_frequency_consequences.gpkg")
+	ar := SummarizeOutputsToFrequencyAction{}
+	ar.Action = cc.Action{
+		IOManager: cc.IOManager{
+			Attributes: map[string]any{
+				tablenameKey:                         outputLayerName,
+				eadOrdinateCapKey:                    50,
+				blockFilePathKey:                     blockFilePath,
+				realizationNumberKey:                 1,
+				resultPathPatternKey:                 resultPathPattern,
+				outputDriverKey:                      "GPKG",
+				spatialOutputDriverKey:               "GPKG",
+				outputTableNameKey:                   "summary",
+				realizationResultFilePathKey:         csvPath,
+				realizationSpatialResultsFilePathKey: spatialPath,
+			}},
+	}
+	err := ar.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	//spatial output has one feature per structure with the frequency summary fields.
+	ds, ok := gdal.OGRDriverByName("GPKG").Open(spatialPath, int(gdal.ReadOnly))
+	if !ok {
+		t.Fatalf("could not open %v", spatialPath)
+	}
+	defer ds.Destroy()
+	l := ds.LayerByName("summary")
+	fc, _ := l.FeatureCount(true)
+	if fc != 2 {
+		t.Errorf("expected 2 structures in the spatial output, got %v", fc)
+	}
+	def := l.Definition()
+	for _, field := range []string{"fd_id", "x", "y", "SAAL", "CAAL", "TAAL", "DAEP", "500yrDam", "10yrDam", "500yrD", "10yrV"} {
+		if def.FieldIndex(field) < 0 {
+			t.Errorf("spatial output is missing field %v", field)
+		}
+	}
+	taal := make(map[string]float64)
+	for i := 0; i < fc; i++ {
+		f := l.NextFeature()
+		taal[f.FieldAsString(def.FieldIndex("fd_id"))] = f.FieldAsFloat64(def.FieldIndex("TAAL"))
+		f.Destroy()
+	}
+	if taal["a"] != 19 || taal["b"] != 22.5 {
+		t.Errorf("unexpected TAAL values %v", taal)
+	}
+	//csv output has a header with a column per block followed by a summary row and three rows per curve for each structure.
+	file, err := os.Open(csvPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	lines := make([]string, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if lines[0] != "fd_id,x,y,SAAL,CAAL,TAAL,DAEP,0.25000,0.50000,0.75000" {
+		t.Errorf("unexpected csv header %v", lines[0])
+	}
+	if len(lines) != 1+2*(1+8*3) {
+		t.Errorf("expected %v csv lines, got %v", 1+2*(1+8*3), len(lines))
+	}
+	if !strings.HasPrefix(lines[1], "a,") || !strings.HasPrefix(lines[25], "b,") {
+		t.Errorf("expected structure summary rows for a and b, got %v and %v", lines[1], lines[25])
+	}
+	if lines[2] != ",,,,,structure_damage,event_id,2,6,5" {
+		t.Errorf("unexpected structure damage event row %v", lines[2])
+	}
+	if lines[10] != ",,,,,total_damage,value,45.00,10.50,1.50" {
+		t.Errorf("unexpected total damage value row %v", lines[10])
+	}
+}
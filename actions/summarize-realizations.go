@@ -0,0 +1,351 @@
+package actions
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/usace-cloud-compute/cc-go-sdk"
+)
+
+const (
+	realizationNumbersKey              string = "realizationNumbers"              //comma separated realization numbers or ranges, e.g. 1-10,12
+	realizationFrequencyPathPatternKey string = "realizationFrequencyPathPattern" //path to each realization's summarize-outputs-to-frequency csv with a %v for the realization number
+	structureRollupFilePathKey         string = "structureRollupFilePath"
+	watershedRollupFilePathKey         string = "watershedRollupFilePath"
+	curveReturnPeriodsKey              string = "curveReturnPeriods" //optional, return periods for the watershed curve confidence bands.
+	defaultCurveReturnPeriods          string = "2, 5, 10, 20, 50, 100, 200, 500, 1000"
+	summarizeRealizationsActionName    string = "summarize-realizations"
+)
+
+func init() {
+	cc.ActionRegistry.RegisterAction(summarizeRealizationsActionName, &SummarizeRealizationsAction{})
+}
+
+// SummarizeRealizationsAction combines the summarize-outputs-to-frequency csv of many realizations into distributions per structure and for the watershed.
+type SummarizeRealizationsAction struct {
+	cc.ActionRunnerBase
+}
+
+// Distribution describes a value across realizations.
+type Distribution struct {
+	Mean   float64
+	Median float64
+	P05    float64
+	P95    float64
+}
+
+// summarizeDistribution computes the mean and the 5th, 50th and 95th percentiles of a set of values, the values are sorted in place.
+func summarizeDistribution(values []float64) Distribution {
+	if len(values) == 0 {
+		return Distribution{}
+	}
+	sort.Float64s(values)
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return Distribution{
+		Mean:   sum / float64(len(values)),
+		Median: percentile(values, 0.5),
+		P05:    percentile(values, 0.05),
+		P95:    percentile(values, 0.95),
+	}
+}
+
+// percentile linearly interpolates between the order statistics of sorted values.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	h := p * float64(len(sorted)-1)
+	lower := int(math.Floor(h))
+	if lower >= len(sorted)-1 {
+		return sorted[len(sorted)-1]
+	}
+	return sorted[lower] + (h-float64(lower))*(sorted[lower+1]-sorted[lower])
+}
+
+// parseRealizationNumbers parses a comma separated list of realization numbers where an entry may be an inclusive range like 1-10.
+func parseRealizationNumbers(s string) ([]int, error) {
+	realizations := make([]int, 0)
+	for _, p := range strings.Split(s, ",") {
+		p = strings.TrimSpace(p)
+		bounds := strings.SplitN(p, "-", 2)
+		start, err := strconv.Atoi(strings.TrimSpace(bounds[0]))
+		if err != nil {
+			return nil, err
+		}
+		end := start
+		if len(bounds) == 2 {
+			end, err = strconv.Atoi(strings.TrimSpace(bounds[1]))
+			if err != nil {
+				return nil, err
+			}
+		}
+		if end < start {
+			return nil, errors.New("invalid realization range " + p)
+		}
+		for r := start; r <= end; r++ {
+			realizations = append(realizations, r)
+		}
+	}
+	return realizations, nil
+}
+
+// realizationStructure is one structure's summary read back from a realization's frequency csv.
+type realizationStructure struct {
+	Fdid        string
+	X           float64
+	Y           float64
+	SAAL        float64
+	CAAL        float64
+	TAAL        float64
+	TotalDamage []BlockEventValue
+}
+
+// frequencyFileReader reads the structures of a summarize-outputs-to-frequency csv in the order they were written, which is fd_id order.
+type frequencyFileReader struct {
+	file       *os.File
+	scanner    *bufio.Scanner
+	BlockCount int
+	next       *realizationStructure
+	line       []string
+	err        error
+}
+
+func openFrequencyFile(path string) (*frequencyFileReader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 1024*1024), 64*1024*1024)
+	if !scanner.Scan() {
+		file.Close()
+		return nil, errors.New("empty frequency file " + path)
+	}
+	header := strings.Split(scanner.Text(), ",")
+	if len(header) < 7 || header[0] != "fd_id" {
+		file.Close()
+		return nil, errors.New("unexpected frequency file header in " + path)
+	}
+	r := &frequencyFileReader{file: file, scanner: scanner, BlockCount: len(header) - 7}
+	r.advance()
+	return r, nil
+}
+
+// advance reads the next structure row and its curve rows into next, next is nil at the end of the file.
+func (r *frequencyFileReader) advance() {
+	r.next = nil
+	if r.line == nil {
+		if !r.scanner.Scan() {
+			r.err = r.scanner.Err()
+			return
+		}
+		r.line = strings.Split(r.scanner.Text(), ",")
+	}
+	if len(r.line) < 6 || r.line[0] == "" {
+		r.err = errors.New("expected a structure row in " + r.file.Name())
+		return
+	}
+	s := &realizationStructure{Fdid: r.line[0]}
+	values := make([]float64, 5)
+	for i := range values {
+		values[i], r.err = strconv.ParseFloat(r.line[i+1], 64)
+		if r.err != nil {
+			return
+		}
+	}
+	s.X, s.Y, s.SAAL, s.CAAL, s.TAAL = values[0], values[1], values[2], values[3], values[4]
+	r.line = nil
+	blocks := make([]string, 0)
+	for r.scanner.Scan() {
+		line := strings.Split(r.scanner.Text(), ",")
+		if line[0] != "" {
+			r.line = line
+			break
+		}
+		//curve rows are ,,,,,variable,row_type,values...
+		if len(line) < 7 || line[5] != "total_damage" {
+			continue
+		}
+		switch line[6] {
+		case "block_id":
+			blocks = line[7:]
+		case "value":
+			for i, v := range line[7:] {
+				value, err := strconv.ParseFloat(v, 64)
+				if err != nil {
+					r.err = err
+					return
+				}
+				block := 0
+				if i < len(blocks) {
+					block, _ = strconv.Atoi(blocks[i])
+				}
+				s.TotalDamage = append(s.TotalDamage, BlockEventValue{BlockNumber: int32(block), Value: value})
+			}
+		}
+	}
+	r.err = r.scanner.Err()
+	r.next = s
+}
+func (r *frequencyFileReader) Close() error {
+	return r.file.Close()
+}
+
+func (ar *SummarizeRealizationsAction) Run() error {
+	a := ar.Action
+	realizations, err := parseRealizationNumbers(a.Attributes.GetStringOrFail(realizationNumbersKey))
+	if err != nil {
+		return err
+	}
+	pathPattern := a.Attributes.GetStringOrFail(realizationFrequencyPathPatternKey)
+	structureRollupFilePath := a.Attributes.GetStringOrFail(structureRollupFilePathKey)
+	watershedRollupFilePath := a.Attributes.GetStringOrFail(watershedRollupFilePathKey)
+	returnPeriods, err := parseReturnPeriods(a.Attributes.GetStringOrDefault(returnPeriodsKey, defaultReturnPeriods))
+	if err != nil {
+		return err
+	}
+	curveReturnPeriods, err := parseReturnPeriods(a.Attributes.GetStringOrDefault(curveReturnPeriodsKey, defaultCurveReturnPeriods))
+	if err != nil {
+		return err
+	}
+	plottingPosition, err := ParsePlottingPosition(a.Attributes.GetStringOrDefault(plottingPositionKey, string(Weibull)))
+	if err != nil {
+		return err
+	}
+	paths := make([]string, len(realizations))
+	for i, r := range realizations {
+		paths[i] = fmt.Sprintf(pathPattern, r)
+	}
+	structureFile, err := os.Create(structureRollupFilePath)
+	if err != nil {
+		return err
+	}
+	defer structureFile.Close()
+	watershedFile, err := os.Create(watershedRollupFilePath)
+	if err != nil {
+		return err
+	}
+	defer watershedFile.Close()
+	return summarizeRealizations(paths, returnPeriods, curveReturnPeriods, plottingPosition, structureFile, watershedFile)
+}
+
+// summarizeRealizations merges the realization frequency files by fd_id so only one structure per realization is held in memory.
+// a structure missing from a realization was never wet in it and contributes zeros.
+func summarizeRealizations(paths []string, returnPeriods []float64, curveReturnPeriods []float64, plottingPosition PlottingPosition, structureOutput *os.File, watershedOutput *os.File) error {
+	readers := make([]*frequencyFileReader, len(paths))
+	for i, path := range paths {
+		r, err := openFrequencyFile(path)
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+		readers[i] = r
+	}
+	ordinals := make([][]int, len(readers))
+	for i, r := range readers {
+		ordinals[i] = make([]int, len(returnPeriods))
+		for j, rp := range returnPeriods {
+			o, ok := plottingPosition.Ordinal(rp, r.BlockCount)
+			if !ok {
+				log.Printf("the %v return period is rarer than %v blocks can support in %v, reporting zero\n", rp, r.BlockCount, paths[i])
+			}
+			ordinals[i][j] = o
+		}
+	}
+	metrics := []string{"SAAL", "CAAL", "TAAL"}
+	for _, rp := range returnPeriods {
+		metrics = append(metrics, returnPeriodLabel(rp)+"Dam")
+	}
+	w := bufio.NewWriter(structureOutput)
+	w.WriteString("fd_id,x,y")
+	for _, m := range metrics {
+		w.WriteString(fmt.Sprintf(",%v_mean,%v_median,%v_p05,%v_p95", m, m, m, m))
+	}
+	w.WriteString("\n")
+	watershedAAL := make([]float64, len(readers))
+	blockTotals := make([]map[int32]float64, len(readers))
+	for i := range blockTotals {
+		blockTotals[i] = make(map[int32]float64)
+	}
+	values := make([][]float64, len(metrics))
+	for {
+		fdid := ""
+		var x, y float64
+		for _, r := range readers {
+			if r.err != nil {
+				return r.err
+			}
+			if r.next != nil && (fdid == "" || r.next.Fdid < fdid) {
+				fdid, x, y = r.next.Fdid, r.next.X, r.next.Y
+			}
+		}
+		if fdid == "" {
+			break
+		}
+		for m := range values {
+			values[m] = make([]float64, len(readers))
+		}
+		for i, r := range readers {
+			s := r.next
+			if s == nil || s.Fdid != fdid {
+				continue
+			}
+			values[0][i], values[1][i], values[2][i] = s.SAAL, s.CAAL, s.TAAL
+			for j, o := range ordinals[i] {
+				values[3+j][i] = valueAtOrdinal(s.TotalDamage, o)
+			}
+			watershedAAL[i] += s.TAAL
+			for _, v := range s.TotalDamage {
+				blockTotals[i][v.BlockNumber] += v.Value
+			}
+			r.advance()
+		}
+		w.WriteString(fmt.Sprintf("%v,%v,%v", fdid, x, y))
+		for m := range values {
+			d := summarizeDistribution(values[m])
+			w.WriteString(fmt.Sprintf(",%.2f,%.2f,%.2f,%.2f", d.Mean, d.Median, d.P05, d.P95))
+		}
+		_, err := w.WriteString("\n")
+		if err != nil {
+			return err
+		}
+	}
+	err := w.Flush()
+	if err != nil {
+		return err
+	}
+	//the watershed curve of each realization is its block totals sorted largest to smallest, dry blocks are zero.
+	curves := make([][]BlockEventValue, len(readers))
+	for i, totals := range blockTotals {
+		curve := make([]BlockEventValue, 0, len(totals))
+		for b, v := range totals {
+			curve = append(curve, BlockEventValue{BlockNumber: b, Value: v})
+		}
+		sortBlockEventValues(curve)
+		curves[i] = curve
+	}
+	ww := bufio.NewWriter(watershedOutput)
+	ww.WriteString("metric,return_period,aep,mean,median,p05,p95\n")
+	d := summarizeDistribution(watershedAAL)
+	ww.WriteString(fmt.Sprintf("aal,,,%.2f,%.2f,%.2f,%.2f\n", d.Mean, d.Median, d.P05, d.P95))
+	for _, rp := range curveReturnPeriods {
+		damages := make([]float64, len(readers))
+		for i, r := range readers {
+			o, _ := plottingPosition.Ordinal(rp, r.BlockCount)
+			damages[i] = valueAtOrdinal(curves[i], o)
+		}
+		d := summarizeDistribution(damages)
+		ww.WriteString(fmt.Sprintf("damage,%v,%.5f,%.2f,%.2f,%.2f,%.2f\n", rp, 1.0/rp, d.Mean, d.Median, d.P05, d.P95))
+	}
+	return ww.Flush()
+}
@@ -0,0 +1,112 @@
+package actions
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeRealizationFrequencyFile writes a csv in the summarize-outputs-to-frequency layout for four blocks.
+func writeRealizationFrequencyFile(t *testing.T, path string, structures []realizationStructure) {
+	sb := strings.Builder{}
+	sb.WriteString("fd_id,x,y,SAAL,CAAL,TAAL,DAEP,0.20000,0.40000,0.60000,0.80000\n")
+	for _, s := range structures {
+		sb.WriteString(fmt.Sprintf("%v,1,2,0.00,0.00,%.2f,0.5000\n", s.Fdid, s.TAAL))
+		sb.WriteString(generateHazardRows("structure_damage", s.TotalDamage))
+		sb.WriteString(generateHazardRows("total_damage", s.TotalDamage))
+		sb.WriteString(generateHazardRows("depth", s.TotalDamage))
+	}
+	err := os.WriteFile(path, []byte(sb.String()), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_SummarizeRealizations(t *testing.T) {
+	dir := t.TempDir()
+	paths := []string{filepath.Join(dir, "r1.csv"), filepath.Join(dir, "r2.csv")}
+	writeRealizationFrequencyFile(t, paths[0], []realizationStructure{
+		{Fdid: "a", TAAL: 10, TotalDamage: []BlockEventValue{{BlockNumber: 1, Value: 30}, {BlockNumber: 2, Value: 10}}},
+		{Fdid: "b", TAAL: 5, TotalDamage: []BlockEventValue{{BlockNumber: 2, Value: 20}}},
+	})
+	writeRealizationFrequencyFile(t, paths[1], []realizationStructure{
+		{Fdid: "a", TAAL: 20, TotalDamage: []BlockEventValue{{BlockNumber: 3, Value: 80}}},
+		{Fdid: "c", TAAL: 2, TotalDamage: []BlockEventValue{{BlockNumber: 1, Value: 8}}},
+	})
+	structureFile, err := os.Create(filepath.Join(dir, "structures.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer structureFile.Close()
+	watershedFile, err := os.Create(filepath.Join(dir, "watershed.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer watershedFile.Close()
+	err = summarizeRealizations(paths, []float64{4}, []float64{4}, Weibull, structureFile, watershedFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	structures, _ := os.ReadFile(structureFile.Name())
+	lines := strings.Split(strings.TrimSpace(string(structures)), "\n")
+	expected := []string{
+		"fd_id,x,y,SAAL_mean,SAAL_median,SAAL_p05,SAAL_p95,CAAL_mean,CAAL_median,CAAL_p05,CAAL_p95,TAAL_mean,TAAL_median,TAAL_p05,TAAL_p95,4yrDam_mean,4yrDam_median,4yrDam_p05,4yrDam_p95",
+		"a,1,2,0.00,0.00,0.00,0.00,0.00,0.00,0.00,0.00,15.00,15.00,10.50,19.50,55.00,55.00,32.50,77.50",
+		"b,1,2,0.00,0.00,0.00,0.00,0.00,0.00,0.00,0.00,2.50,2.50,0.25,4.75,10.00,10.00,1.00,19.00",
+		"c,1,2,0.00,0.00,0.00,0.00,0.00,0.00,0.00,0.00,1.00,1.00,0.10,1.90,4.00,4.00,0.40,7.60",
+	}
+	if len(lines) != len(expected) {
+		t.Fatalf("expected %v lines, got %v", len(expected), len(lines))
+	}
+	for i, e := range expected {
+		if lines[i] != e {
+			t.Errorf("line %v: expected %v, got %v", i, e, lines[i])
+		}
+	}
+	watershed, _ := os.ReadFile(watershedFile.Name())
+	lines = strings.Split(strings.TrimSpace(string(watershed)), "\n")
+	//realization one blocks 1 and 2 both total 30, realization two block 3 totals 80.
+	expected = []string{
+		"metric,return_period,aep,mean,median,p05,p95",
+		"aal,,,18.50,18.50,15.35,21.65",
+		"damage,4,0.25000,55.00,55.00,32.50,77.50",
+	}
+	for i, e := range expected {
+		if lines[i] != e {
+			t.Errorf("line %v: expected %v, got %v", i, e, lines[i])
+		}
+	}
+}
+
+func Test_SummarizeDistribution(t *testing.T) {
+	d := summarizeDistribution([]float64{5, 1, 4, 2, 3})
+	if d.Mean != 3 || d.Median != 3 {
+		t.Errorf("expected mean and median of 3, got %v and %v", d.Mean, d.Median)
+	}
+	if math.Abs(d.P05-1.2) > 1e-9 || math.Abs(d.P95-4.8) > 1e-9 {
+		t.Errorf("expected 5th and 95th percentiles of 1.2 and 4.8, got %v and %v", d.P05, d.P95)
+	}
+}
+
+func Test_ParseRealizationNumbers(t *testing.T) {
+	realizations, err := parseRealizationNumbers("1-3, 7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []int{1, 2, 3, 7}
+	if len(realizations) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, realizations)
+	}
+	for i, e := range expected {
+		if realizations[i] != e {
+			t.Errorf("expected %v, got %v", expected, realizations)
+		}
+	}
+	_, err = parseRealizationNumbers("5-2")
+	if err == nil {
+		t.Errorf("expected a descending range to be rejected")
+	}
+}
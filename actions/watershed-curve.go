@@ -0,0 +1,123 @@
+package actions
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// WatershedCurveOrdinate is one block on the watershed damage-frequency curve.
+type WatershedCurveOrdinate struct {
+	Rank             int                `json:"rank"`
+	AEP              float64            `json:"aep"`
+	BlockNumber      int32              `json:"block_id"`
+	EventNumber      int32              `json:"event_id"`       //the event driving the block
+	MissingEvents    int                `json:"missing_events"` //events in the block without a readable output
+	TotalDamage      float64            `json:"total_damage"`
+	PopulationAtRisk float64            `json:"population_at_risk"`
+	LifeLoss         float64            `json:"life_loss"`
+	CategoryDamage   map[string]float64 `json:"category_damage"`
+	OccupancyDamage  map[string]float64 `json:"occupancy_damage"`
+}
+
+// WatershedCurve is the damage-frequency curve of the watershed total damage for a realization.
+type WatershedCurve struct {
+	Realization      int                      `json:"realization"`
+	BlockCount       int                      `json:"block_count"`
+	PlottingPosition PlottingPosition         `json:"plotting_position"`
+	AAL              float64                  `json:"aal"`
+	EAPAR            float64                  `json:"eapar"` //expected annual population at risk
+	EALL             float64                  `json:"eall"`  //expected annual life loss
+	CategoryAAL      map[string]float64       `json:"category_aal"`
+	OccupancyAAL     map[string]float64       `json:"occupancy_aal"`
+	Categories       []string                 `json:"categories"`
+	Ordinates        []WatershedCurveOrdinate `json:"ordinates"`
+}
+
+// buildWatershedCurve sorts the block totals largest to smallest and assigns each an exceedance probability out of blockCount blocks.
+func buildWatershedCurve(realization int, totals []WatershedBlockTotal, blockCount int, plottingPosition PlottingPosition) WatershedCurve {
+	sorted := make([]WatershedBlockTotal, len(totals))
+	copy(sorted, totals)
+	sort.SliceStable(sorted, func(i int, j int) bool {
+		if sorted[i].TotalDamage == sorted[j].TotalDamage {
+			return sorted[i].BlockNumber < sorted[j].BlockNumber
+		}
+		return sorted[i].TotalDamage > sorted[j].TotalDamage
+	})
+	curve := WatershedCurve{
+		Realization:      realization,
+		BlockCount:       blockCount,
+		PlottingPosition: plottingPosition,
+		CategoryAAL:      make(map[string]float64),
+		OccupancyAAL:     make(map[string]float64),
+		Categories:       make([]string, 0),
+		Ordinates:        make([]WatershedCurveOrdinate, len(sorted)),
+	}
+	for i, t := range sorted {
+		curve.Ordinates[i] = WatershedCurveOrdinate{
+			Rank:             i + 1,
+			AEP:              plottingPosition.ExceedanceProbability(i+1, blockCount),
+			BlockNumber:      t.BlockNumber,
+			EventNumber:      t.DrivingEvent.EventNumber,
+			TotalDamage:      t.TotalDamage,
+			PopulationAtRisk: t.PopulationAtRisk,
+			LifeLoss:         t.LifeLoss,
+			CategoryDamage:   t.CategoryDamage,
+			OccupancyDamage:  t.OccupancyDamage,
+		}
+		curve.AAL += t.TotalDamage
+		curve.EAPAR += t.PopulationAtRisk
+		curve.EALL += t.LifeLoss
+		for c, v := range t.CategoryDamage {
+			if _, ok := curve.CategoryAAL[c]; !ok {
+				curve.Categories = append(curve.Categories, c)
+			}
+			curve.CategoryAAL[c] += v
+		}
+		for o, v := range t.OccupancyDamage {
+			curve.OccupancyAAL[o] += v
+		}
+	}
+	sort.Strings(curve.Categories)
+	if blockCount > 0 {
+		curve.AAL = curve.AAL / float64(blockCount)
+		curve.EAPAR = curve.EAPAR / float64(blockCount)
+		curve.EALL = curve.EALL / float64(blockCount)
+		for c := range curve.CategoryAAL {
+			curve.CategoryAAL[c] = curve.CategoryAAL[c] / float64(blockCount)
+		}
+		for o := range curve.OccupancyAAL {
+			curve.OccupancyAAL[o] = curve.OccupancyAAL[o] / float64(blockCount)
+		}
+	}
+	return curve
+}
+
+// WriteCSV writes one row per ordinate with a total damage column for each damage category,
+// there are no category columns when the compute outputs had no damage category.
+func (wc WatershedCurve) WriteCSV(output io.Writer) error {
+	w := bufio.NewWriter(output)
+	categories := breakdownKeys(wc.CategoryAAL)
+	w.WriteString("rank,aep,block_id,event_id,missing_events,total_damage,population_at_risk,life_loss")
+	for _, c := range categories {
+		w.WriteString("," + breakdownLabel(c))
+	}
+	w.WriteString("\n")
+	for _, o := range wc.Ordinates {
+		w.WriteString(fmt.Sprintf("%v,%.5f,%v,%v,%v,%.2f,%.2f,%.2f", o.Rank, o.AEP, o.BlockNumber, o.EventNumber, o.MissingEvents, o.TotalDamage, o.PopulationAtRisk, o.LifeLoss))
+		for _, c := range categories {
+			w.WriteString(fmt.Sprintf(",%.2f", o.CategoryDamage[c]))
+		}
+		w.WriteString("\n")
+	}
+	return w.Flush()
+}
+
+// WriteJSON writes the curve, including the aal, as a single json document.
+func (wc WatershedCurve) WriteJSON(output io.Writer) error {
+	encoder := json.NewEncoder(output)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(wc)
+}
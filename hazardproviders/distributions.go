@@ -0,0 +1,83 @@
+package hazardproviders
+
+import (
+	"errors"
+	"math"
+
+	"github.com/HydrologicEngineeringCenter/go-statistics/statistics"
+)
+
+// Distribution is the shape used to sample a hazard parameter from its mean and standard deviation grids.
+type Distribution string
+
+const (
+	Normal          Distribution = "normal"
+	LogNormal       Distribution = "lognormal"
+	TruncatedNormal Distribution = "truncated-normal" //normal truncated at zero
+	Triangular      Distribution = "triangular"       //symmetric about the mean
+)
+
+func ParseDistribution(s string) (Distribution, error) {
+	switch Distribution(s) {
+	case Normal, LogNormal, TruncatedNormal, Triangular:
+		return Distribution(s), nil
+	default:
+		return Normal, errors.New("unknown distribution " + s + ", expected normal, lognormal, truncated-normal or triangular")
+	}
+}
+
+// FromMoments returns the distribution with the provided mean and standard deviation. a value without uncertainty is deterministic.
+func (d Distribution) FromMoments(mean float64, stdev float64) statistics.ContinuousDistribution {
+	if stdev <= 0 {
+		return statistics.DeterministicDistribution{Value: mean}
+	}
+	switch d {
+	case LogNormal:
+		//a lognormal can not describe a mean at or below zero, which is dry.
+		if mean <= 0 {
+			return statistics.DeterministicDistribution{Value: mean}
+		}
+		sigma2 := math.Log(1 + (stdev*stdev)/(mean*mean))
+		return statistics.LogNormalDistribution{Mean: math.Log(mean) - sigma2/2, StandardDeviation: math.Sqrt(sigma2)}
+	case TruncatedNormal:
+		return truncatedNormalDistribution{parent: statistics.NormalDistribution{Mean: mean, StandardDeviation: stdev}}
+	case Triangular:
+		//a symmetric triangle with half width w has a variance of w^2/6.
+		w := stdev * math.Sqrt(6)
+		return statistics.TriangularDistribution{Min: mean - w, MostLikely: mean, Max: mean + w}
+	default:
+		return statistics.NormalDistribution{Mean: mean, StandardDeviation: stdev}
+	}
+}
+
+// truncatedNormalDistribution is a normal distribution without the probability below zero, the mean and standard deviation are of the parent normal.
+type truncatedNormalDistribution struct {
+	parent statistics.NormalDistribution
+}
+
+func (t truncatedNormalDistribution) lower() float64 {
+	return t.parent.CDF(0)
+}
+func (t truncatedNormalDistribution) InvCDF(probability float64) float64 {
+	l := t.lower()
+	if l >= 1 {
+		return 0
+	}
+	return math.Max(0, t.parent.InvCDF(l+probability*(1-l)))
+}
+func (t truncatedNormalDistribution) CDF(value float64) float64 {
+	if value <= 0 {
+		return 0
+	}
+	l := t.lower()
+	return (t.parent.CDF(value) - l) / (1 - l)
+}
+func (t truncatedNormalDistribution) PDF(value float64) float64 {
+	if value < 0 {
+		return 0
+	}
+	return t.parent.PDF(value) / (1 - t.lower())
+}
+func (t truncatedNormalDistribution) CentralTendency() float64 {
+	return t.InvCDF(.5)
+}
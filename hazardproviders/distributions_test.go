@@ -0,0 +1,49 @@
+package hazardproviders
+
+import (
+	"math"
+	"testing"
+)
+
+func Test_DistributionsMatchMoments(t *testing.T) {
+	slices := make([]float64, 9999)
+	for i := range slices {
+		slices[i] = float64(i+1) / 10000
+	}
+	for _, d := range []Distribution{Normal, LogNormal, Triangular} {
+		dist := d.FromMoments(3, 1)
+		sum, sumsq := 0.0, 0.0
+		for _, p := range slices {
+			v := dist.InvCDF(p)
+			sum += v
+			sumsq += v * v
+		}
+		mean := sum / float64(len(slices))
+		stdev := math.Sqrt(sumsq/float64(len(slices)) - mean*mean)
+		if math.Abs(mean-3) > 0.01 || math.Abs(stdev-1) > 0.02 {
+			t.Errorf("expected %v to have a mean of 3 and a standard deviation of 1, got %v and %v", d, mean, stdev)
+		}
+	}
+}
+
+func Test_DistributionsWithoutNegativeDepths(t *testing.T) {
+	for _, d := range []Distribution{LogNormal, TruncatedNormal} {
+		dist := d.FromMoments(0.5, 1)
+		for _, p := range []float64{0.001, 0.05, 0.5, 0.95} {
+			if v := dist.InvCDF(p); v < 0 {
+				t.Errorf("expected %v to be non negative at %v, got %v", d, p, v)
+			}
+		}
+	}
+	tn := TruncatedNormal.FromMoments(0, 1)
+	if math.Abs(tn.InvCDF(0.5)-0.6745) > 0.001 {
+		t.Errorf("expected the median of a half normal to be 0.6745, got %v", tn.InvCDF(0.5))
+	}
+	if v := Normal.FromMoments(2, 0).InvCDF(0.1); v != 2 {
+		t.Errorf("expected a deterministic value of 2 without uncertainty, got %v", v)
+	}
+	_, err := ParseDistribution("gamma")
+	if err == nil {
+		t.Error("expected an error for an unknown distribution")
+	}
+}
@@ -1,7 +1,8 @@
 package hazardproviders
 
 import (
-	"time"
+	"errors"
+	"math"
 
 	"github.com/HydrologicEngineeringCenter/go-statistics/statistics"
 	"github.com/USACE/go-consequences/geography"
@@ -9,99 +10,305 @@ import (
 	"github.com/USACE/go-consequences/hazards"
 )
 
+// ParameterGrids are the mean and standard deviation grids of one hazard parameter.
+type ParameterGrids struct {
+	Parameter hazards.Parameter
+	MeanPath  string
+	StdevPath string
+}
+
+// Mean_and_stdev_HazardProvider samples every configured hazard parameter from a distribution, normal unless set, at each vertical slice
+// or at random quantiles when sampling is set. without a depth-velocity correlation all parameters share each quantile, which assumes they are perfectly correlated.
 type Mean_and_stdev_HazardProvider struct {
-	meandepthcr     cogReader
-	stevdepthcr     cogReader
-	meanvelocitycr  cogReader
-	stdevvelocitycr cogReader
-	VerticalSlice   []float64
-	//meandurationcr cogReader
-	//stdevdurationcr cogReader
-	Process gc.HazardFunction
-}
-
-func Init(mdfp string, sdfp string, mvfp string, svfp string, verticalSlice []float64) (Mean_and_stdev_HazardProvider, error) {
-	md, err := initCR(mdfp)
-	if err != nil {
-		return Mean_and_stdev_HazardProvider{}, err
+	parameters    []hazards.Parameter
+	meancrs       []cogReader
+	stdevcrs      []cogReader
+	VerticalSlice []float64
+	Process       gc.HazardFunction
+	Distribution  Distribution
+	correlated    bool
+	correlation   float64
+	correlationcr *cogReader
+	sampling      *Sampling
+}
+
+var standardNormal = statistics.NormalDistribution{Mean: 0, StandardDeviation: 1}
+
+// JointStandardNormals pairs each vertical slice with every vertical slice through CorrelatedStandardNormals, each pair has equal weight.
+// n slices give n*n samples, every residual meets every slice so the standard normals have a sample correlation of exactly rho at any slice count.
+func JointStandardNormals(verticalSlice []float64, rho float64) ([]float64, []float64) {
+	ps := make([]float64, 0, len(verticalSlice)*len(verticalSlice))
+	qs := make([]float64, 0, len(verticalSlice)*len(verticalSlice))
+	for _, p := range verticalSlice {
+		for _, q := range verticalSlice {
+			ps = append(ps, p)
+			qs = append(qs, q)
+		}
 	}
-	sd, err := initCR(sdfp)
-	if err != nil {
-		return Mean_and_stdev_HazardProvider{}, err
+	return CorrelatedStandardNormals(ps, qs, rho)
+}
+
+// CorrelatedStandardNormals converts pairs of independent quantiles into standard normals with correlation rho
+// through a gaussian copula, z2 = rho*z1 + sqrt(1-rho^2)*z.
+func CorrelatedStandardNormals(ps []float64, qs []float64, rho float64) ([]float64, []float64) {
+	z1s := make([]float64, len(ps))
+	z2s := make([]float64, len(ps))
+	residual := math.Sqrt(1 - rho*rho)
+	for i := range ps {
+		z1s[i] = standardNormal.InvCDF(ps[i])
+		z2s[i] = rho*z1s[i] + residual*standardNormal.InvCDF(qs[i])
 	}
-	mv, err := initCR(mvfp)
-	if err != nil {
-		return Mean_and_stdev_HazardProvider{}, err
+	return z1s, z2s
+}
+
+// SampledParameters are the hazard parameters that can be described by a mean and standard deviation grid.
+var SampledParameters = []hazards.Parameter{hazards.Depth, hazards.Velocity, hazards.Erosion, hazards.Duration, hazards.WaveHeight}
+
+// IsSampledParameter reports whether a hazard parameter can be described by a mean and standard deviation grid.
+func IsSampledParameter(p hazards.Parameter) bool {
+	for _, sp := range SampledParameters {
+		if sp == p {
+			return true
+		}
 	}
-	sv, err := initCR(svfp)
-	if err != nil {
-		return Mean_and_stdev_HazardProvider{}, err
+	return false
+}
+
+// ParameterValue returns the value of a sampled hazard parameter from an event.
+func ParameterValue(e hazards.HazardEvent, p hazards.Parameter) float64 {
+	switch p {
+	case hazards.Depth:
+		return e.Depth()
+	case hazards.Velocity:
+		return e.Velocity()
+	case hazards.Erosion:
+		return e.Erosion()
+	case hazards.Duration:
+		return e.Duration()
+	case hazards.WaveHeight:
+		return e.WaveHeight()
+	default:
+		return 0
+	}
+}
+
+// InitHazardData sets each parameter to its value, parameters that are not provided are marked missing with -901.
+func InitHazardData(parameters []hazards.Parameter, values []float64) hazards.HazardData {
+	hd := hazards.HazardData{
+		Depth:      -901,
+		Velocity:   -901,
+		Erosion:    -901,
+		Duration:   -901,
+		WaveHeight: -901,
+		DV:         -901,
+	}
+	for i, p := range parameters {
+		hd.SetParameter(p, values[i])
 	}
-	return Mean_and_stdev_HazardProvider{meandepthcr: md, stevdepthcr: sd, meanvelocitycr: mv, stdevvelocitycr: sv, VerticalSlice: verticalSlice}, err
+	return hd
+}
+
+// Init opens the grids of each parameter, the first parameter's mean grid defines the boundary and spatial reference.
+func Init(grids []ParameterGrids, verticalSlice []float64) (Mean_and_stdev_HazardProvider, error) {
+	hp := Mean_and_stdev_HazardProvider{VerticalSlice: verticalSlice, Distribution: Normal}
+	if len(grids) == 0 {
+		return hp, errors.New("at least one hazard parameter is required")
+	}
+	for _, g := range grids {
+		if !IsSampledParameter(g.Parameter) {
+			return hp, errors.New("hazard parameter " + g.Parameter.String() + " can not be sampled from a mean and standard deviation")
+		}
+		mean, err := initCR(g.MeanPath)
+		if err != nil {
+			hp.Close()
+			return hp, err
+		}
+		stdev, err := initCR(g.StdevPath)
+		if err != nil {
+			mean.Close()
+			hp.Close()
+			return hp, err
+		}
+		hp.parameters = append(hp.parameters, g.Parameter)
+		hp.meancrs = append(hp.meancrs, mean)
+		hp.stdevcrs = append(hp.stdevcrs, stdev)
+	}
+	return hp, nil
 }
 func (hp Mean_and_stdev_HazardProvider) Close() {
-	hp.meandepthcr.Close()
-	hp.stevdepthcr.Close()
-	hp.meanvelocitycr.Close()
-	hp.stdevvelocitycr.Close()
+	for i := range hp.meancrs {
+		hp.meancrs[i].Close()
+		hp.stdevcrs[i].Close()
+	}
+	if hp.correlationcr != nil {
+		hp.correlationcr.Close()
+	}
 }
 func (hp *Mean_and_stdev_HazardProvider) SetProcess(function gc.HazardFunction) {
 	hp.Process = function
 }
-func (chp Mean_and_stdev_HazardProvider) Hazards(l geography.Location) ([]hazards.HazardEvent, error) {
-	var h []hazards.HazardEvent
-	md, err := chp.meandepthcr.ProvideValue(l)
+func (hp *Mean_and_stdev_HazardProvider) SetDistribution(d Distribution) {
+	hp.Distribution = d
+}
+
+// SetSampling replaces the vertical slices with random quantiles.
+func (hp *Mean_and_stdev_HazardProvider) SetSampling(s Sampling) error {
+	err := s.Validate()
 	if err != nil {
-		return h, err
+		return err
 	}
-	sd, err := chp.stevdepthcr.ProvideValue(l)
-	if err != nil {
-		return h, err
+	hp.sampling = &s
+	return nil
+}
+
+// SetDepthVelocityCorrelation samples velocity jointly with depth using a constant correlation coefficient.
+func (hp *Mean_and_stdev_HazardProvider) SetDepthVelocityCorrelation(rho float64) error {
+	if rho < -1 || rho > 1 {
+		return errors.New("the depth-velocity correlation must be between -1 and 1")
+	}
+	if hp.parameterIndex(hazards.Depth) < 0 || hp.parameterIndex(hazards.Velocity) < 0 {
+		return errors.New("a depth-velocity correlation requires depth and velocity grids")
 	}
-	mv, err := chp.meanvelocitycr.ProvideValue(l)
+	hp.correlated = true
+	hp.correlation = rho
+	return nil
+}
+
+// SetDepthVelocityCorrelationGrid samples velocity jointly with depth using the correlation coefficient of a grid,
+// the constant correlation is used where the grid has no value.
+func (hp *Mean_and_stdev_HazardProvider) SetDepthVelocityCorrelationGrid(fp string, rho float64) error {
+	err := hp.SetDepthVelocityCorrelation(rho)
 	if err != nil {
-		return h, err
+		return err
 	}
-	sv, err := chp.stdevvelocitycr.ProvideValue(l)
+	cr, err := initCR(fp)
 	if err != nil {
-		return h, err
-	}
-	depthDist := statistics.NormalDistribution{
-		Mean:              md,
-		StandardDeviation: sd,
-	}
-	velocityDist := statistics.NormalDistribution{
-		Mean:              mv,
-		StandardDeviation: sv,
-	}
-	for _, p := range chp.VerticalSlice {
-		d := depthDist.InvCDF(p)
-		v := velocityDist.InvCDF(p)
-		hd := hazards.HazardData{
-			Depth:       d,
-			Velocity:    v,
-			ArrivalTime: time.Time{},
-			Erosion:     0,
-			Duration:    0,
-			WaveHeight:  0,
-			Salinity:    false,
-			Qualitative: "",
+		return err
+	}
+	hp.correlationcr = &cr
+	return nil
+}
+func (hp Mean_and_stdev_HazardProvider) parameterIndex(p hazards.Parameter) int {
+	for i, parameter := range hp.parameters {
+		if parameter == p {
+			return i
+		}
+	}
+	return -1
+}
+
+// Parameters returns the sampled hazard parameters in the order they were configured.
+func (hp Mean_and_stdev_HazardProvider) Parameters() []hazards.Parameter {
+	return hp.parameters
+}
+
+// Hazards returns an event per sample, a sample without a hazard is nil so every sample is kept. no hazard is found when every sample is dry.
+func (chp Mean_and_stdev_HazardProvider) Hazards(l geography.Location) ([]hazards.HazardEvent, error) {
+	var h []hazards.HazardEvent
+	dists := make([]statistics.ContinuousDistribution, len(chp.parameters))
+	for i := range chp.parameters {
+		m, err := chp.meancrs[i].ProvideValue(l)
+		if err != nil {
+			return h, err
+		}
+		s, err := chp.stdevcrs[i].ProvideValue(l)
+		if err != nil {
+			return h, err
+		}
+		dists[i] = chp.Distribution.FromMoments(m, s)
+	}
+	ps := chp.VerticalSlice
+	var qs []float64
+	if chp.sampling != nil {
+		ps, qs = chp.sampling.Quantiles(l)
+	}
+	if !chp.correlated {
+		return chp.sampledHazards(dists, ps)
+	}
+	rho := chp.correlationAt(l)
+	if chp.sampling != nil {
+		z1s, z2s := CorrelatedStandardNormals(ps, qs, rho)
+		return chp.correlatedHazards(dists, z1s, z2s)
+	}
+	z1s, z2s := JointStandardNormals(ps, rho)
+	return chp.correlatedHazards(dists, z1s, z2s)
+}
+
+// correlationAt returns the depth-velocity correlation at a location, the constant is used where the grid has no value.
+func (chp Mean_and_stdev_HazardProvider) correlationAt(l geography.Location) float64 {
+	if chp.correlationcr != nil {
+		r, err := chp.correlationcr.ProvideValue(l)
+		if err == nil {
+			return math.Max(-1, math.Min(1, r))
+		}
+	}
+	return chp.correlation
+}
+
+// processSample returns a nil event for a sample the process finds no hazard in, so the sample still counts as dry.
+func (chp Mean_and_stdev_HazardProvider) processSample(values []float64) (hazards.HazardEvent, error) {
+	estimate, err := chp.Process(InitHazardData(chp.parameters, values), nil)
+	if _, dry := err.(gc.NoHazardFoundError); dry {
+		return nil, nil
+	}
+	return estimate, err
+}
+
+// wetSamples returns the samples unless every sample is dry.
+func wetSamples(h []hazards.HazardEvent) ([]hazards.HazardEvent, error) {
+	for _, e := range h {
+		if e != nil {
+			return h, nil
+		}
+	}
+	return h, gc.NoHazardFoundError{}
+}
+
+// sampledHazards evaluates every parameter at the same quantiles.
+func (chp Mean_and_stdev_HazardProvider) sampledHazards(dists []statistics.ContinuousDistribution, ps []float64) ([]hazards.HazardEvent, error) {
+	var h []hazards.HazardEvent
+	values := make([]float64, len(chp.parameters))
+	for _, p := range ps {
+		for i := range chp.parameters {
+			values[i] = dists[i].InvCDF(p)
+		}
+		estimate, err := chp.processSample(values)
+		if err != nil {
+			return h, err
+		}
+		h = append(h, estimate)
+	}
+	return wetSamples(h)
+}
+
+// correlatedHazards samples velocity from the copula with depth, other parameters share the depth quantile.
+func (chp Mean_and_stdev_HazardProvider) correlatedHazards(dists []statistics.ContinuousDistribution, z1s []float64, z2s []float64) ([]hazards.HazardEvent, error) {
+	var h []hazards.HazardEvent
+	values := make([]float64, len(chp.parameters))
+	velocity := chp.parameterIndex(hazards.Velocity)
+	for j := range z1s {
+		for i, d := range dists {
+			z := z1s[j]
+			if i == velocity {
+				z = z2s[j]
+			}
+			values[i] = d.InvCDF(standardNormal.CDF(z))
 		}
-		estimate, err := chp.Process(hd, nil)
+		estimate, err := chp.processSample(values)
 		if err != nil {
 			return h, err
 		}
 		h = append(h, estimate)
 	}
-	return h, err
+	return wetSamples(h)
 }
 
 func (chp Mean_and_stdev_HazardProvider) HazardBoundary() (geography.BBox, error) {
-	return chp.meandepthcr.GetBoundingBox()
+	return chp.meancrs[0].GetBoundingBox()
 }
 func (chp Mean_and_stdev_HazardProvider) SpatialReference() string {
-	return chp.meandepthcr.SpatialReference()
+	return chp.meancrs[0].SpatialReference()
 }
 func (chp Mean_and_stdev_HazardProvider) UpdateSpatialReference(sr_wkt string) {
-	chp.meandepthcr.UpdateSpatialReference(sr_wkt)
+	chp.meancrs[0].UpdateSpatialReference(sr_wkt)
 }
@@ -0,0 +1,86 @@
+package hazardproviders
+
+import (
+	"math"
+	"testing"
+
+	"github.com/HydrologicEngineeringCenter/go-statistics/statistics"
+	gc "github.com/USACE/go-consequences/hazardproviders"
+	"github.com/USACE/go-consequences/hazards"
+)
+
+func sampleCorrelation(x []float64, y []float64) float64 {
+	mx, my := 0.0, 0.0
+	for i := range x {
+		mx += x[i]
+		my += y[i]
+	}
+	mx /= float64(len(x))
+	my /= float64(len(y))
+	sxy, sxx, syy := 0.0, 0.0, 0.0
+	for i := range x {
+		sxy += (x[i] - mx) * (y[i] - my)
+		sxx += (x[i] - mx) * (x[i] - mx)
+		syy += (y[i] - my) * (y[i] - my)
+	}
+	return sxy / math.Sqrt(sxx*syy)
+}
+
+func Test_JointStandardNormals(t *testing.T) {
+	slices := make([]float64, 99)
+	for i := range slices {
+		slices[i] = float64(i+1) / 100
+	}
+	for _, rho := range []float64{-0.6, 0, 0.5, 1} {
+		z1s, z2s := JointStandardNormals(slices, rho)
+		if len(z1s) != len(slices)*len(slices) {
+			t.Fatalf("expected %v pairs, got %v", len(slices)*len(slices), len(z1s))
+		}
+		r := sampleCorrelation(z1s, z2s)
+		if math.Abs(r-rho) > 0.01 {
+			t.Errorf("expected a correlation of %v, got %v", rho, r)
+		}
+	}
+	z1s, z2s := JointStandardNormals(slices, 1)
+	for i := range z1s {
+		if math.Abs(z1s[i]-z2s[i]) > 1e-12 {
+			t.Fatalf("expected identical quantiles with perfect correlation, got %v and %v", z1s[i], z2s[i])
+		}
+	}
+}
+
+func Test_JointStandardNormalsFewSlices(t *testing.T) {
+	for _, slices := range [][]float64{{0.25, 0.75}, {0.05, 0.5, 0.95}, {0.16, 0.5, 0.84}, {0.1, 0.3, 0.5, 0.7, 0.9}} {
+		for _, rho := range []float64{-0.5, 0, 0.5} {
+			z1s, z2s := JointStandardNormals(slices, rho)
+			r := sampleCorrelation(z1s, z2s)
+			if math.Abs(r-rho) > 1e-9 {
+				t.Errorf("expected a correlation of %v with slices %v, got %v", rho, slices, r)
+			}
+		}
+	}
+}
+
+func Test_SampledHazardsKeepDrySamples(t *testing.T) {
+	hp := Mean_and_stdev_HazardProvider{
+		parameters: []hazards.Parameter{hazards.Depth},
+		Process: func(valueIn hazards.HazardData, hazard hazards.HazardEvent) (hazards.HazardEvent, error) {
+			if valueIn.Depth <= 0 {
+				return hazard, gc.NoHazardFoundError{}
+			}
+			return hazards.HazardDataToMultiParameter(valueIn), nil
+		},
+	}
+	dists := []statistics.ContinuousDistribution{statistics.NormalDistribution{Mean: 0.5, StandardDeviation: 1}}
+	h, err := hp.sampledHazards(dists, []float64{0.1, 0.5, 0.9})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(h) != 3 || h[0] != nil || h[1] == nil || h[2] == nil {
+		t.Errorf("expected the first of three samples to be dry, got %v", h)
+	}
+	_, err = hp.sampledHazards(dists, []float64{0.01, 0.1})
+	if _, dry := err.(gc.NoHazardFoundError); !dry {
+		t.Errorf("expected no hazard when every sample is dry, got %v", err)
+	}
+}
@@ -0,0 +1,72 @@
+package hazardproviders
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+
+	"github.com/USACE/go-consequences/geography"
+)
+
+// SamplingMethod chooses how the quantiles of each structure's hazard distributions are selected.
+type SamplingMethod string
+
+const (
+	VerticalSlices SamplingMethod = "vertical-slice"  //the configured list of quantiles
+	MonteCarlo     SamplingMethod = "monte-carlo"     //independent uniform draws
+	LatinHypercube SamplingMethod = "latin-hypercube" //one draw from each of n equally likely strata
+)
+
+func ParseSamplingMethod(s string) (SamplingMethod, error) {
+	switch SamplingMethod(s) {
+	case VerticalSlices, MonteCarlo, LatinHypercube:
+		return SamplingMethod(s), nil
+	default:
+		return VerticalSlices, errors.New("unknown sampling method " + s + ", expected vertical-slice, monte-carlo or latin-hypercube")
+	}
+}
+
+// Sampling draws random quantiles for a structure, the draws only depend on the seed and the location so results do not depend on the order structures are computed in
+// and every frequency sees the same draws.
+type Sampling struct {
+	Method  SamplingMethod
+	Samples int
+	Seed    int64
+}
+
+func (s Sampling) Validate() error {
+	if s.Method != MonteCarlo && s.Method != LatinHypercube {
+		return errors.New("sampling requires the monte-carlo or latin-hypercube method")
+	}
+	if s.Samples < 1 {
+		return errors.New("sampling requires at least one sample")
+	}
+	return nil
+}
+
+// Quantiles returns two independent columns of sampled probabilities, the second is only used to sample a correlated parameter.
+func (s Sampling) Quantiles(l geography.Location) ([]float64, []float64) {
+	rng := rand.New(rand.NewSource(s.Seed ^ int64(math.Float64bits(l.X)) ^ int64(math.Float64bits(l.Y)<<1)))
+	return s.column(rng), s.column(rng)
+}
+func (s Sampling) column(rng *rand.Rand) []float64 {
+	ps := make([]float64, s.Samples)
+	if s.Method == LatinHypercube {
+		for i, stratum := range rng.Perm(s.Samples) {
+			ps[i] = openUnit((float64(stratum) + rng.Float64()) / float64(s.Samples))
+		}
+		return ps
+	}
+	for i := range ps {
+		ps[i] = openUnit(rng.Float64())
+	}
+	return ps
+}
+
+// minimumQuantile bounds sampled probabilities away from 0 and 1, the inverse cdfs are not finite at the bounds.
+const minimumQuantile float64 = 1e-10
+
+// openUnit keeps a probability strictly between 0 and 1 so its inverse cdf is finite.
+func openUnit(p float64) float64 {
+	return math.Min(math.Max(p, minimumQuantile), 1-minimumQuantile)
+}
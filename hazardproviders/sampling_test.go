@@ -0,0 +1,60 @@
+package hazardproviders
+
+import (
+	"math"
+	"sort"
+	"testing"
+
+	"github.com/USACE/go-consequences/geography"
+)
+
+func Test_SamplingIsReproducible(t *testing.T) {
+	s := Sampling{Method: MonteCarlo, Samples: 50, Seed: 42}
+	l := geography.Location{X: 1234.5, Y: 6789.25}
+	p1, q1 := s.Quantiles(l)
+	p2, _ := s.Quantiles(l)
+	other, _ := s.Quantiles(geography.Location{X: 1234.5, Y: 6789.5})
+	for i := range p1 {
+		if p1[i] != p2[i] {
+			t.Fatalf("expected the same draws for the same location, got %v and %v", p1[i], p2[i])
+		}
+	}
+	if p1[0] == q1[0] || p1[0] == other[0] {
+		t.Error("expected independent draws for each column and location")
+	}
+}
+
+func Test_LatinHypercubeStratifies(t *testing.T) {
+	s := Sampling{Method: LatinHypercube, Samples: 20, Seed: 7}
+	ps, qs := s.Quantiles(geography.Location{X: 1, Y: 2})
+	for _, column := range [][]float64{ps, qs} {
+		sorted := append([]float64{}, column...)
+		sort.Float64s(sorted)
+		for i, p := range sorted {
+			if p < float64(i)/20 || p >= float64(i+1)/20 {
+				t.Errorf("expected draw %v to fall in stratum %v, got %v", i, i, p)
+			}
+		}
+	}
+	err := Sampling{Method: VerticalSlices, Samples: 20}.Validate()
+	if err == nil {
+		t.Error("expected an error when sampling with vertical slices")
+	}
+}
+
+func Test_SamplingQuantilesAreOpen(t *testing.T) {
+	for _, p := range []float64{0, 1} {
+		q := openUnit(p)
+		if q <= 0 || q >= 1 {
+			t.Errorf("expected %v to be moved inside (0,1), got %v", p, q)
+		}
+		for _, d := range []Distribution{Normal, LogNormal, TruncatedNormal, Triangular} {
+			if v := d.FromMoments(2, 1).InvCDF(q); math.IsInf(v, 0) || math.IsNaN(v) {
+				t.Errorf("expected a finite %v sample for %v, got %v", d, p, v)
+			}
+		}
+	}
+	if openUnit(0.25) != 0.25 {
+		t.Error("expected probabilities inside (0,1) to be unchanged")
+	}
+}